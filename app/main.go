@@ -1,48 +1,160 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
-	"github.com/codecrafters-io/shell-starter-go/internal/completer"
 	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/completer"
 	"github.com/codecrafters-io/shell-starter-go/internal/cmd/commands"
 	"github.com/codecrafters-io/shell-starter-go/internal/history"
+	"github.com/codecrafters-io/shell-starter-go/internal/interp"
 	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
 )
 
+const (
+	prompt 		   = "$ "
+	continuePrompt = "> "	// for the next lines of an incomplete command
+)
 
+// invocation is what was asked on the command line.
+type invocation struct {
+	command    string // -c string
+	hasCommand bool
+	script     string // script filename
+}
 
 func main() {
-	history := history.NewHistory()
+	sh := state.NewShell(os.Args[0])
+	runner := interp.NewRunner(sh)
+
+	inv, err := parseArgs(sh, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", sh.Name, err)
+		os.Exit(2)
+	}
+
+	// without the interactive shell history stays empty, but the builtins still work on it
+	hist := history.NewHistory()
+	hist.Getenv = sh.Get
+	hist.Option = sh.Option
+	commands.History = &hist
+
+	status := 0
+	switch {
+	case inv.hasCommand:
+		status = runSource(runner, bufio.NewReader(strings.NewReader(inv.command)))
+	case inv.script != "":
+		f, err := os.Open(inv.script)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s: No such file or directory\n", os.Args[0], inv.script)
+			os.Exit(127)
+		}
+		status = runSource(runner, bufio.NewReader(f))
+		f.Close()
+	case !readline.IsTerminal(int(os.Stdin.Fd())):
+		// unbuffered, so that the commands read the rest of stdin themselves
+		status = runSource(runner, byteReader{os.Stdin})
+	default:
+		sh.Interactive = true
+		sh.SetOption("histexpand", true)
+		status = runInteractive(runner, &hist)
+	}
+
+	os.Exit(status)
+}
+
+// parseArgs handles the forms:
+// shell [script [args...]], shell -c cmds [name [args...]], shell -s [args...].
+func parseArgs(sh *state.Shell, args []string) (invocation, error) {
+	inv := invocation{}
+	readStdin := false
+
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" {
+			i++
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || len(arg) == 1 {
+			break
+		}
+
+		for _, opt := range arg[1:] {
+			switch opt {
+			case 'c':
+				inv.hasCommand = true
+			case 's':
+				readStdin = true
+			default:
+				// the options of set
+				name, ok := state.OptionByFlag(byte(opt))
+				if !ok {
+					return inv, fmt.Errorf("-%c: invalid option", opt)
+				}
+				sh.SetOption(name, true)
+			}
+		}
+	}
+	args = args[i:]
 
+	switch {
+	case inv.hasCommand:
+		if len(args) == 0 {
+			return inv, fmt.Errorf("-c: option requires an argument")
+		}
+		inv.command = args[0]
+		if len(args) > 1 {
+			sh.Name = args[1]
+			sh.Params = args[2:]
+		}
+	case readStdin:
+		sh.Params = args
+	case len(args) > 0:
+		inv.script = args[0]
+		sh.Name = args[0]
+		sh.Params = args[1:]
+	}
+
+	return inv, nil
+}
+
+// runInteractive reads commands with readline, saving them in history.
+func runInteractive(runner *interp.Runner, history *history.History) int {
 	// load old history
-	historyFilename := os.Getenv("HISTFILE")
+	historyFilename := history.File()
 	if historyFilename != "" {
+		// a missing file is made by the first save, an unreadable one must not stop the shell
 		err := history.ReadHistoryFromFile(historyFilename)
-		if err != nil {
-			return
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
 		}
 
-		defer history.AppendHistoryToFile(historyFilename)
+		defer saveHistory(history)
+		history.RecordTo(historyFilename)
 	}
 
-	commands.History = &history
-
 	rl, err := readline.NewEx(&readline.Config{
-		Prompt: "$ ",
-		AutoComplete: completer.NewCmdCompleter(),
+		Prompt: prompt,
+		AutoComplete: completer.NewCmdCompleter(runner.Sh),
 		InterruptPrompt: "^C",
 		EOFPrompt: "exit",
 		Listener: readline.FuncListener(history.WalkByHistory),
+		Painter: history,
 	})
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		return
+		return 1
 	}
 
 	defer func() {
@@ -51,58 +163,219 @@ func main() {
 		}
 	}()
 
+	editor := &lineEditor{rl: rl, prompt: prompt}
+	rl.Config.FuncFilterInputRune = history.SearchFilter(editor)
+
+	// read takes the lines typed for it from readline too
+	cmd.Terminal = editor
+	defer func() { cmd.Terminal = nil }()
+
+	// with histshare the history file is shared with the other shells at once
+	share := func() {
+		if history.File() == "" || !runner.Sh.Option("histshare") {
+			return
+		}
+		if err := history.SyncFile(history.File()); err != nil {
+			fmt.Fprintf(os.Stderr, "history: %v\n", err)
+		}
+	}
+
+	input := ""
+	line := 1
 	for {
+		share()
 		inputRaw, err := rl.Readline()
 		if err != nil {
 			// io.EOF (Ctrl+D) / readline.ErrInterrupt (Ctrl+C)
 			break
 		}
-		
-		if inputRaw == "" {
+
+		if inputRaw == "" && input == "" {
 			continue
 		}
 
-		history.PushBackOneLine(inputRaw, true)
-		
-		inputSliceCmds, err := parser.ParseInput(inputRaw)
-		// skip empty input
-		if err != nil {
+		if runner.Sh.Option("histexpand") {
+			expanded, print, err := history.Expand(inputRaw)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				continue
+			}
+			// the expanded line is shown, saved in the history and run instead
+			if expanded != inputRaw {
+				fmt.Println(expanded)
+				inputRaw = expanded
+			}
+			if print {
+				history.Add(inputRaw)
+				share()
+				continue
+			}
+		}
+
+		if runner.Sh.Option("verbose") {
+			fmt.Fprintln(os.Stderr, inputRaw)
+		}
+
+		input += inputRaw + "\n"
+		dir, start, saved := runner.Sh.Dir, time.Time{}, false
+		complete, exit := execute(runner, input, line, func() {
+			// the lines of a function or a here-document are one record, Up shows them together
+			saved = history.Add(strings.TrimSuffix(input, "\n"))
+			share()
+			start = time.Now()
+		})
+		// a command left out of history, like one with a space before it for ignorespace, is not recorded either
+		if saved {
+			err := history.Record(strings.TrimSuffix(input, "\n"), dir, runner.Sh.Status, start)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "history: %v\n", err)
+			}
+		}
+		if !complete {
+			editor.SetPrompt(continuePrompt)
 			continue
 		}
 
-		if len(inputSliceCmds) == 1 && inputSliceCmds[0][0] == "exit" {
-			return
+		line += strings.Count(input, "\n")
+		input = ""
+		editor.SetPrompt(prompt)
+		if exit {
+			break
+		}
+	}
+
+	return runner.Sh.Status
+}
+
+// lineEditor is readline with the prompt of the commands,
+// the incremental search of history shows itself in it.
+type lineEditor struct {
+	rl 	   *readline.Instance
+	prompt string
+}
+
+func (le *lineEditor) Prompt() string {
+	return le.prompt
+}
+
+func (le *lineEditor) SetPrompt(prompt string) {
+	le.prompt = prompt
+	le.rl.SetPrompt(prompt)
+}
+
+func (le *lineEditor) SetBuffer(line string) {
+	le.rl.Operation.SetBuffer(line)
+}
+
+// ReadLine reads lines for the builtins, without the completion and the history of commands.
+func (le *lineEditor) ReadLine(prompt string) (string, error) {
+	cfg := *le.rl.Config
+	cfg.Prompt = prompt
+	cfg.AutoComplete = nil
+	cfg.Listener = nil
+	cfg.FuncFilterInputRune = nil
+	cfg.DisableAutoSaveHistory = true
+
+	old := le.rl.SetConfig(&cfg)
+	defer le.rl.SetConfig(old)
+
+	return le.rl.Readline()
+}
+
+// lineReader is what runSource needs from its input.
+type lineReader interface {
+	ReadString(delim byte) (string, error)
+}
+
+// saveHistory appends the commands of the session to the history file, HISTFILE as it is at the end.
+func saveHistory(h *history.History) {
+	if h.File() == "" {
+		return
+	}
+	err := h.AppendHistoryToFile(h.File())
+	if err != nil && !errors.Is(err, history.HistoryIsEmpty) && !errors.Is(err, history.NoNewRecords) {
+		fmt.Fprintf(os.Stderr, "history: %v\n", err)
+	}
+}
+
+// runSource runs the commands read from r, without prompts and history.
+// Returns the exit status of the last command.
+func runSource(runner *interp.Runner, r lineReader) int {
+	input := ""
+	lineno := 1
+	for {
+		line, err := r.ReadString('\n')
+		input += line
+		if runner.Sh.Option("verbose") {
+			fmt.Fprint(os.Stderr, line)
 		}
 
-		cmds := parser.HandleInputToCmds(inputSliceCmds)
+		if input != "" && (strings.HasSuffix(line, "\n") || err != nil) {
+			complete, exit := execute(runner, input, lineno, nil)
+			if exit {
+				break
+			}
+			if complete {
+				lineno += strings.Count(input, "\n")
+				input = ""
+			}
+		}
 
-		for _, curCmd := range cmds.Cmds {
-			if err := curCmd.SetupRedirection(); err != nil {
-				fmt.Fprintf(curCmd.Stderr, "%v\n", err)
-        		continue
+		if err != nil {
+			if input != "" {
+				fmt.Fprintf(os.Stderr, "syntax error: unexpected end of file\n")
+				runner.Sh.Status = 2
 			}
-			defer curCmd.CloseFiles()
+			break
 		}
+	}
 
-		if cmds.CountCmd > 1 {
-			cmds.ExecPipeline()
-		} else if cmds.CountCmd == 1 {
-			curCmd := cmds.Cmds[0]
+	return runner.Sh.Status
+}
 
-			if cmd.CheckIfBuiltinCmd(curCmd.Cmd) {
-				err := curCmd.ExecBuiltinCmd()
-				if err != nil {
-					fmt.Fprintf(curCmd.Stderr, "%v\n", err)
-				}
-			} else {
-				err := curCmd.ExecOtherCommand()
-				if err != nil {
-					var exitErr *exec.ExitError
-					if !errors.As(err, &exitErr) {
-						fmt.Fprintf(curCmd.Stderr, "%v\n", err)
-					}
-				}
+// byteReader reads one byte at a time and never takes more input than the line it returns.
+type byteReader struct {
+	r io.Reader
+}
+
+func (br byteReader) ReadString(delim byte) (string, error) {
+	buf := strings.Builder{}
+	b := make([]byte, 1)
+	for {
+		n, err := br.r.Read(b)
+		if n == 1 {
+			buf.WriteByte(b[0])
+			if b[0] == delim {
+				return buf.String(), nil
 			}
 		}
+		if err != nil {
+			return buf.String(), err
+		}
+	}
+}
+
+// execute parses the input and runs it.
+// Returns complete false if the input ends in the middle of a command and more lines are needed,
+// exit true if the shell has to exit. line is the number of the first line of input.
+// parsed, if not nil, is called once the command is complete, before it runs.
+func execute(runner *interp.Runner, input string, line int, parsed func()) (complete bool, exit bool) {
+	list, err := parser.ParseAtLine(input, line)
+	if errors.Is(err, parser.ErrIncomplete) {
+		return false, false
+	}
+	if parsed != nil {
+		parsed()
 	}
-}
\ No newline at end of file
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		runner.Sh.Status = 2
+		return true, false
+	}
+
+	if err := runner.Run(list); err != nil {
+		return true, true
+	}
+
+	return true, false
+}
@@ -4,4 +4,4 @@ go 1.25.0
 
 require github.com/chzyer/readline v1.5.1
 
-require golang.org/x/sys v0.41.0 // indirect
+require golang.org/x/sys v0.41.0
@@ -0,0 +1,566 @@
+package arith
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Vars is the storage of shell variables that expressions read and assign.
+type Vars interface {
+	Get(name string) (string, bool)
+	Set(name, value string) error
+}
+
+// optioner is implemented by storages that know the options of the shell.
+type optioner interface {
+	Option(name string) bool
+}
+
+// a variable may hold an expression which refers to another variable
+const maxDepth = 64
+
+type evaluator struct {
+	expr  string			// the source, errors show it
+	toks  []string
+	offs  []int				// offsets of the tokens in expr
+	right int				// token that starts the right operand of the last binary operator
+	pos   int
+	vars  Vars
+	skip  int				// > 0 while the right side of && or || is not evaluated
+	depth int
+}
+
+// Eval evaluates the integer arithmetic expression.
+// Variables are referred to by name and read from vars, assignments are written to vars.
+func Eval(expr string, vars Vars) (int64, error) {
+	return eval(expr, vars, 0)
+}
+
+func eval(expr string, vars Vars, depth int) (int64, error) {
+	if depth > maxDepth {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", expr)
+	}
+
+	toks, offs, err := tokenize(expr)
+	if err != nil {
+		return 0, err
+	}
+	if len(toks) == 0 {
+		return 0, nil
+	}
+
+	e := &evaluator{expr: expr, toks: toks, offs: offs, vars: vars, depth: depth}
+	n, err := e.comma()
+	if err != nil {
+		return 0, err
+	}
+	if e.pos < len(e.toks) {
+		return 0, fmt.Errorf("%s: syntax error in expression (error token is \"%s\")", expr, e.source(e.pos))
+	}
+
+	return n, nil
+}
+
+// operators, the longest first
+var operators = []string{
+	"<<=", ">>=",
+	"**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=",
+	"+", "-", "*", "/", "%", "<", ">", "!", "~", "&", "|", "^", "=", "?", ":", "(", ")", ",",
+}
+
+// tokenize returns the tokens of the expression and their offsets in it.
+func tokenize(expr string) ([]string, []int, error) {
+	toks := []string{}
+	offs := []int{}
+
+	for i := 0; i < len(expr); {
+		ch := expr[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			i++
+		case isAlnum(ch) || ch == '#':
+			start := i
+			for i < len(expr) && (isAlnum(expr[i]) || expr[i] == '#' || expr[i] == '@') {
+				i++
+			}
+			// an element of an array is name[subscript]
+			if i < len(expr) && expr[i] == '[' && isName(expr[start:i]) {
+				end := subscriptEnd(expr, i)
+				if end == -1 {
+					return nil, nil, fmt.Errorf("%s: bad array subscript", expr)
+				}
+				i = end + 1
+			}
+			toks = append(toks, expr[start:i])
+			offs = append(offs, start)
+		default:
+			found := false
+			for _, op := range operators {
+				if strings.HasPrefix(expr[i:], op) {
+					toks = append(toks, op)
+					offs = append(offs, i)
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, nil, fmt.Errorf("%s: syntax error: invalid arithmetic operator (error token is \"%s\")", expr, expr[i:])
+			}
+		}
+	}
+
+	return toks, offs, nil
+}
+
+// subscriptEnd returns the index of the ] closing the [ at expr[start], or -1.
+func subscriptEnd(expr string, start int) int {
+	depth := 0
+	for i := start; i < len(expr); i++ {
+		switch expr[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isAlnum(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+// isName reports whether the token is a variable, which may be an element name[subscript].
+func isName(tok string) bool {
+	if i := strings.IndexByte(tok, '['); i > 0 && strings.HasSuffix(tok, "]") {
+		tok = tok[:i]
+	}
+	if tok == "" || '0' <= tok[0] && tok[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(tok); i++ {
+		if !isAlnum(tok[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *evaluator) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return ""
+}
+
+func (e *evaluator) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s", e.expr, fmt.Sprintf(format, args...))
+}
+
+// source returns the expression from the token i on, as it was written.
+func (e *evaluator) source(i int) string {
+	if i >= len(e.offs) {
+		return ""
+	}
+	return e.expr[e.offs[i]:]
+}
+
+// syntaxError shows the token where an operand is missing, the last one at the end.
+func (e *evaluator) syntaxError() error {
+	return e.errorf("syntax error: operand expected (error token is \"%s\")", e.source(min(e.pos, len(e.toks)-1)))
+}
+
+// comma is expr , expr
+func (e *evaluator) comma() (int64, error) {
+	n, err := e.assign()
+	for err == nil && e.peek() == "," {
+		e.pos++
+		n, err = e.assign()
+	}
+	return n, err
+}
+
+var assignOps = map[string]string{
+	"=": "", "+=": "+", "-=": "-", "*=": "*", "/=": "/", "%=": "%",
+	"<<=": "<<", ">>=": ">>", "&=": "&", "|=": "|", "^=": "^",
+}
+
+// assign is name op= expr, right associative
+func (e *evaluator) assign() (int64, error) {
+	if e.pos + 1 < len(e.toks) && isName(e.toks[e.pos]) {
+		if op, ok := assignOps[e.toks[e.pos+1]]; ok {
+			name := e.toks[e.pos]
+			e.pos += 2
+			right := e.pos
+
+			n, err := e.assign()
+			if err != nil {
+				return 0, err
+			}
+			if op != "" {
+				old, err := e.variable(name)
+				if err != nil {
+					return 0, err
+				}
+				e.right = right
+				if n, err = e.binaryOp(op, old, n); err != nil {
+					return 0, err
+				}
+			}
+
+			return n, e.setVariable(name, n)
+		}
+	}
+
+	return e.ternary()
+}
+
+// ternary is cond ? expr : expr
+func (e *evaluator) ternary() (int64, error) {
+	cond, err := e.binary(0)
+	if err != nil || e.peek() != "?" {
+		return cond, err
+	}
+	e.pos++
+
+	if cond == 0 {
+		e.skip++
+	}
+	yes, err := e.assign()
+	if cond == 0 {
+		e.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if e.peek() != ":" {
+		return 0, e.syntaxError()
+	}
+	e.pos++
+
+	if cond != 0 {
+		e.skip++
+	}
+	no, err := e.assign()
+	if cond != 0 {
+		e.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if cond != 0 {
+		return yes, nil
+	}
+	return no, nil
+}
+
+// precedence of binary operators, from the lowest
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, ">": 7, "<=": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+	"**": 11,
+}
+
+// binary parses operators with precedence higher than minPrec.
+func (e *evaluator) binary(minPrec int) (int64, error) {
+	left, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		op := e.peek()
+		prec, ok := precedence[op]
+		if !ok || prec <= minPrec {
+			return left, nil
+		}
+		e.pos++
+		start := e.pos
+
+		// the right side of && and || is not evaluated if the result is already known
+		shortCut := (op == "&&" && left == 0) || (op == "||" && left != 0)
+		if shortCut {
+			e.skip++
+		}
+
+		var right int64
+		if op == "**" {
+			// right associative
+			right, err = e.binary(prec - 1)
+		} else {
+			right, err = e.binary(prec)
+		}
+
+		if shortCut {
+			e.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		e.right = start
+		if left, err = e.binaryOp(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (e *evaluator) binaryOp(op string, left, right int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolToInt(left != 0 || right != 0), nil
+	case "&&":
+		return boolToInt(left != 0 && right != 0), nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	case "&":
+		return left & right, nil
+	case "==":
+		return boolToInt(left == right), nil
+	case "!=":
+		return boolToInt(left != right), nil
+	case "<":
+		return boolToInt(left < right), nil
+	case ">":
+		return boolToInt(left > right), nil
+	case "<=":
+		return boolToInt(left <= right), nil
+	case ">=":
+		return boolToInt(left >= right), nil
+	case "<<":
+		return left << uint64(right & 63), nil
+	case ">>":
+		return left >> uint64(right & 63), nil
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			if e.skip > 0 {
+				return 0, nil
+			}
+			return 0, e.errorf("division by 0 (error token is \"%s\")", e.source(e.right))
+		}
+		// the only overflow of division
+		if left == -1 << 63 && right == -1 {
+			if op == "/" {
+				return left, nil
+			}
+			return 0, nil
+		}
+		if op == "/" {
+			return left / right, nil
+		}
+		return left % right, nil
+	case "**":
+		if right < 0 {
+			if e.skip > 0 {
+				return 0, nil
+			}
+			return 0, e.errorf("exponent less than 0 (error token is \"%s\")", e.source(min(e.pos, len(e.toks)-1)))
+		}
+		result := int64(1)
+		for ; right > 0; right-- {
+			result *= left
+		}
+		return result, nil
+	}
+
+	return 0, e.errorf("unknown operator %s", op)
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// unary is - + ! ~ ++name --name
+func (e *evaluator) unary() (int64, error) {
+	switch op := e.peek(); op {
+	case "-", "+", "!", "~":
+		e.pos++
+		n, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "-":
+			return -n, nil
+		case "!":
+			return boolToInt(n == 0), nil
+		case "~":
+			return ^n, nil
+		}
+		return n, nil
+	case "++", "--":
+		e.pos++
+		name := e.peek()
+		if !isName(name) {
+			return 0, e.syntaxError()
+		}
+		e.pos++
+
+		n, err := e.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		if op == "++" {
+			n++
+		} else {
+			n--
+		}
+		return n, e.setVariable(name, n)
+	}
+
+	return e.postfix()
+}
+
+// postfix is name++ name-- or a primary
+func (e *evaluator) postfix() (int64, error) {
+	name := e.peek()
+	if isName(name) && e.pos + 1 < len(e.toks) && (e.toks[e.pos+1] == "++" || e.toks[e.pos+1] == "--") {
+		op := e.toks[e.pos+1]
+		e.pos += 2
+
+		n, err := e.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		next := n + 1
+		if op == "--" {
+			next = n - 1
+		}
+		return n, e.setVariable(name, next)
+	}
+
+	return e.primary()
+}
+
+// primary is number, name or ( expr )
+func (e *evaluator) primary() (int64, error) {
+	tok := e.peek()
+	switch {
+	case tok == "(":
+		e.pos++
+		n, err := e.comma()
+		if err != nil {
+			return 0, err
+		}
+		if e.peek() != ")" {
+			return 0, e.errorf("missing `)' (error token is \"%s\")", e.peek())
+		}
+		e.pos++
+		return n, nil
+	case isName(tok):
+		e.pos++
+		return e.variable(tok)
+	case tok != "" && isAlnum(tok[0]):
+		e.pos++
+		return e.number(tok)
+	}
+
+	return 0, e.syntaxError()
+}
+
+// number parses decimal, 0x hexadecimal, 0 octal and base#digits numbers.
+func (e *evaluator) number(tok string) (int64, error) {
+	base := 10
+	digits := tok
+
+	if b, rest, ok := strings.Cut(tok, "#"); ok {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 2 || n > 64 {
+			return 0, e.errorf("invalid arithmetic base (error token is \"%s\")", tok)
+		}
+		base = n
+		digits = rest
+	} else if strings.HasPrefix(tok, "0x") || strings.HasPrefix(tok, "0X") {
+		base = 16
+		digits = tok[2:]
+	} else if len(tok) > 1 && tok[0] == '0' {
+		base = 8
+		digits = tok[1:]
+	}
+
+	if digits == "" {
+		return 0, e.errorf("invalid number (error token is \"%s\")", tok)
+	}
+
+	var n int64
+	for i := 0; i < len(digits); i++ {
+		d := digitValue(digits[i], base)
+		if d < 0 || d >= base {
+			return 0, e.errorf("value too great for base (error token is \"%s\")", tok)
+		}
+		n = n*int64(base) + int64(d)
+	}
+
+	return n, nil
+}
+
+// digitValue returns the value of a digit: 0-9, a-z, A-Z, @, _.
+// Letters are case insensitive for bases up to 36.
+func digitValue(ch byte, base int) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'z':
+		return int(ch - 'a') + 10
+	case 'A' <= ch && ch <= 'Z':
+		if base <= 36 {
+			return int(ch - 'A') + 10
+		}
+		return int(ch - 'A') + 36
+	case ch == '@':
+		return 62
+	case ch == '_':
+		return 63
+	}
+	return -1
+}
+
+// variable returns the value of the variable, which is evaluated as an expression itself.
+func (e *evaluator) variable(name string) (int64, error) {
+	value, ok := e.vars.Get(name)
+	if opts, isOptioner := e.vars.(optioner); !ok && e.skip == 0 && isOptioner && opts.Option("nounset") {
+		return 0, fmt.Errorf("%s: unbound variable", name)
+	}
+	if !ok || strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+
+	if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+		return n, nil
+	}
+	return eval(value, e.vars, e.depth + 1)
+}
+
+func (e *evaluator) setVariable(name string, n int64) error {
+	if e.skip > 0 {
+		return nil
+	}
+	return e.vars.Set(name, strconv.FormatInt(n, 10))
+}
@@ -0,0 +1,148 @@
+package ast
+
+// Words are kept as they were written, with quotes and expansions.
+// They are processed by the expand package right before the command runs.
+
+// List is a sequence of and-or lists separated by ; & or newlines.
+type List struct {
+	Items []*AndOr
+}
+
+// AndOr is pipelines joined with && and ||.
+type AndOr struct {
+	Pipelines  []*Pipeline
+	Ops 	   []string	// "&&" or "||" between Pipelines[i] and Pipelines[i+1]
+	Background bool		// ended with &
+}
+
+type Pipeline struct {
+	Cmds   []Command
+	Negate bool			// starts with !
+}
+
+// Command is a simple or compound command.
+type Command interface {
+	Redirects() []*Redirect
+	AddRedirect(redir *Redirect)
+}
+
+// Redirect is one redirection, e.g. 2>>file, <<EOF, >&2.
+type Redirect struct {
+	Fd 	    int			// -1 if not given, then it depends on Op
+	Op 	    string		// < > >> >| <> <& >& &> &>> << <<- <<<
+	Word    string		// filename, descriptor or here-document delimiter
+	HereDoc *HereDoc	// body for << and <<-
+}
+
+type HereDoc struct {
+	Body   string
+	Quoted bool			// delimiter was quoted, so the body isn't expanded
+}
+
+// Redirs is embedded in all commands.
+type Redirs struct {
+	Redirs []*Redirect
+}
+
+func (r *Redirs) Redirects() []*Redirect {
+	return r.Redirs
+}
+
+func (r *Redirs) AddRedirect(redir *Redirect) {
+	r.Redirs = append(r.Redirs, redir)
+}
+
+// SimpleCmd is [assignments] [words] with redirections anywhere.
+type SimpleCmd struct {
+	Assigns []string	// name=value
+	Words   []string
+	Line 	int			// line number in the source, for LINENO and caller
+	Redirs
+}
+
+// IfCmd is if Conds[0]; then Thens[0]; elif Conds[1]; then Thens[1]; else Else; fi.
+type IfCmd struct {
+	Conds []*List
+	Thens []*List
+	Else  *List
+	Redirs
+}
+
+// WhileCmd is while/until Cond; do Body; done.
+type WhileCmd struct {
+	Cond  *List
+	Body  *List
+	Until bool
+	Redirs
+}
+
+// ForCmd is for Var in Words; do Body; done.
+type ForCmd struct {
+	Var 	string
+	Words 	[]string
+	HasIn 	bool		// without "in" the loop goes over positional parameters
+	Body 	*List
+	Redirs
+}
+
+// ArithForCmd is for ((Init; Cond; Post)); do Body; done.
+type ArithForCmd struct {
+	Init string
+	Cond string
+	Post string
+	Body *List
+	Redirs
+}
+
+// CaseCmd is case Word in Items esac.
+type CaseCmd struct {
+	Word  string
+	Items []*CaseItem
+	Redirs
+}
+
+// CaseItem is Patterns) Body Term.
+type CaseItem struct {
+	Patterns []string
+	Body 	 *List
+	Term 	 string		// ";;", ";&" (fall through) or ";;&" (test next patterns)
+}
+
+// Subshell is ( Body ), run in a copy of the shell state.
+type Subshell struct {
+	Body *List
+	Redirs
+}
+
+// Group is { Body; }, run in the current shell.
+type Group struct {
+	Body *List
+	Redirs
+}
+
+// FuncDecl is name() body or function name body.
+type FuncDecl struct {
+	Name string
+	Body Command		// compound command, its redirections apply on every call
+	Src  string		// the definition as it was written, for type and declare -f
+	Redirs
+}
+
+// CondCmd is [[ Expr ]].
+type CondCmd struct {
+	Expr *CondExpr
+	Redirs
+}
+
+// CondExpr is an expression of [[ ]].
+type CondExpr struct {
+	Op 	  string		// && || ! ( , a test like -f or ==, empty for a single word
+	X, Y  *CondExpr		// operands of && || ! (
+	Words []string		// operands of a test
+}
+
+// ArithCmd is (( Expr )).
+type ArithCmd struct {
+	Expr string
+	Redirs
+}
@@ -4,19 +4,45 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/codecrafters-io/shell-starter-go/internal/cmd/commands"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
 	"github.com/codecrafters-io/shell-starter-go/internal/utils/path"
 )
 
 var builtinCmd = map[string]bool{
-	"exit":    true,
-	"type":    true,
-	"echo":    true,
-	"pwd":     true,
-	"cd": 	   true,
-	"history": true,
+	"exit":     true,
+	"type":     true,
+	"echo":     true,
+	"pwd":      true,
+	"cd": 	    true,
+	"history":  true,
+	"true":     true,
+	"false":    true,
+	":":        true,
+	"break":    true,
+	"continue": true,
+	"export":   true,
+	"local":    true,
+	"return":   true,
+	"unset":    true,
+	"caller":   true,
+	"test":     true,
+	"[":        true,
+	"let":      true,
+	"shift":    true,
+	"set":      true,
+	"declare":  true,
+	"typeset":  true,
+	"readonly": true,
+	"mapfile":  true,
+	"readarray": true,
+	"read":     true,
+	"fc":       true,
 }
 
 func (cc *CurrentCmd) ExecBuiltinCmd() (errOutput error) {
@@ -26,9 +52,73 @@ func (cc *CurrentCmd) ExecBuiltinCmd() (errOutput error) {
 
 	switch cc.Cmd {
 	case "exit":
-		return
+		code := cc.Shell.Status
+		if len(cc.Args) > 0 {
+			n, err := strconv.Atoi(cc.Args[0])
+			if err != nil {
+				fmt.Fprintf(cc.Stderr, "%s: %s: numeric argument required\n", cc.Cmd, cc.Args[0])
+				n = 2
+			}
+			code = n
+		}
+		return &ExitError{Code: code & 0xff}
+	case "true", ":":
+		return nil
+	case "false":
+		return &StatusError{Code: 1}
+	case "break", "continue":
+		n := 1
+		if len(cc.Args) > 0 {
+			var err error
+			n, err = strconv.Atoi(cc.Args[0])
+			if err != nil {
+				return fmt.Errorf("%s: %s: numeric argument required", cc.Cmd, cc.Args[0])
+			}
+			if n < 1 {
+				return fmt.Errorf("%s: %s: loop count out of range", cc.Cmd, cc.Args[0])
+			}
+		}
+		if cc.Cmd == "break" {
+			return &BreakError{N: n}
+		}
+		return &ContinueError{N: n}
+	case "export", "local", "declare", "typeset", "readonly":
+		return cc.declare()
+	case "mapfile", "readarray":
+		return cc.mapfile()
+	case "fc":
+		return cc.fc()
+	case "read":
+		return cc.read()
+	case "return":
+		return cc.returnCmd()
+	case "unset":
+		return cc.unset()
+	case "caller":
+		return cc.caller()
+	case "test", "[":
+		return cc.test()
+	case "let":
+		return cc.let()
+	case "shift":
+		return cc.shift()
+	case "set":
+		return cc.set()
 	case "cd":
 		tmpArgStr := argsStr
+		switch argsStr {
+		case "":
+			tmpArgStr, _ = cc.Shell.Get("HOME")
+			if tmpArgStr == "" {
+				return fmt.Errorf("%s: HOME not set", cc.Cmd)
+			}
+		case "-":
+			tmpArgStr, _ = cc.Shell.Get("OLDPWD")
+			if tmpArgStr == "" {
+				return fmt.Errorf("%s: OLDPWD not set", cc.Cmd)
+			}
+			output = tmpArgStr
+		}
 		if strings.HasPrefix(tmpArgStr, "~") {
 			homeDir, err := os.UserHomeDir()
 			if err != nil {
@@ -37,29 +127,35 @@ func (cc *CurrentCmd) ExecBuiltinCmd() (errOutput error) {
 
 			tmpArgStr = strings.Replace(tmpArgStr, "~", homeDir, 1)
 		}
-		if _, err := os.Stat(tmpArgStr); err != nil {
+		// only the shell moves, other shells of the process keep their directories
+		dir := filepath.Clean(cc.Shell.Path(tmpArgStr))
+		info, err := os.Stat(dir)
+		if err != nil {
 			return fmt.Errorf("%s: %s: No such file or directory", cc.Cmd, argsStr)
 		}
-
-		if err := os.Chdir(tmpArgStr); err != nil {
-			return fmt.Errorf("%s: %s: No such file or directory", cc.Cmd, argsStr)
+		if !info.IsDir() {
+			return fmt.Errorf("%s: %s: Not a directory", cc.Cmd, argsStr)
 		}
+
+		cc.Shell.Chdir(dir)
 	case "pwd":
-		curDir, err := os.Getwd()
-		if err != nil {
-			return fmt.Errorf("%w", err)
-		}
-		output = fmt.Sprintf("%s", curDir)
+		output = cc.Shell.Dir
 	case "echo":
-		output = fmt.Sprintf("%s", argsStr)
+		// even without arguments echo prints the newline
+		_, err := io.WriteString(cc.Stdout, argsStr + "\n")
+		return err
 	case "type":
-		if _, ok := builtinCmd[argsStr]; ok {
+		if parser.IsKeyword(argsStr) {
+			output = fmt.Sprintf("%s is a shell keyword", argsStr)
+		} else if fn, ok := cc.Shell.Funcs[argsStr]; ok {
+			output = fmt.Sprintf("%s is a function\n%s", argsStr, fn.Src)
+		} else if _, ok := builtinCmd[argsStr]; ok {
 			output = fmt.Sprintf("%s is a shell builtin", argsStr)
 		} else {
-			output = path.PrintLookPath(argsStr, path.LookPath(argsStr))
+			output = path.PrintLookPath(argsStr, cc.lookPath(argsStr))
 		}
 	case "history":
-		tmp, err := commands.HandleHistoryCmd(cc.Args)
+		tmp, err := commands.HandleHistoryCmd(cc.Args, cc.Shell.Dir)
 		if err != nil {
 			return fmt.Errorf("%v", err)
 		}
@@ -77,6 +173,13 @@ func (cc *CurrentCmd) argsToString() string {
 	return strings.Join(cc.Args, " ")
 }
 
+// CheckIfFunction reports whether the command is a function defined in the shell,
+// functions are found before builtins and commands in PATH.
+func CheckIfFunction(sh *state.Shell, cmd string) bool {
+	_, exist := sh.Funcs[cmd]
+	return exist
+}
+
 func CheckIfBuiltinCmd(cmd string) bool {
 	if _, exist := builtinCmd[cmd]; !exist {
 		return false
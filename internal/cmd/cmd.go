@@ -3,20 +3,37 @@ package cmd
 import (
 	"io"
 	"os"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
 )
 
 type CurrentCmd struct {
 	Cmd			 string
 	Args  		 []string
+	Shell 		 *state.Shell
+	Arrays 		 map[int][]state.Elem	// values of name=(...) arguments of declaration builtins by index
+	Eval 		 func(src string, s Streams) error	// runs commands in the shell, for fc
+	Streams
+}
+
+// Streams are the file descriptors a command runs with.
+type Streams struct {
     Stdin  		 io.Reader
     Stdout 		 io.Writer
     Stderr 		 io.Writer
+	Fds 		 map[int]*os.File	// descriptors from 3 and up, opened by redirections
 	Redirect
 }
 
 type Redirect struct {
-	Files 		 []string   // save just filename
-	RedirectType string		// > >> 1> 1>> 2> 2>>
-	Flag		 int		// for openning file, example os.O_CREATE | os.O.RD_WR
+	Redirections []Redirection
+	Dir 		 string		// relative filenames are opened in it
 	filesToClose []*os.File
-}
\ No newline at end of file
+}
+
+// Redirection is a redirection with its target already expanded.
+type Redirection struct {
+	Fd 			 int		// -1 if not given, then 0 for input and 1 for output
+	Op 			 string		// < > >> >| <> <& >& &> &>> << <<- <<<
+	Target 		 string		// filename, descriptor number, "-" or text of here-document
+}
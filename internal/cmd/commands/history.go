@@ -4,13 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/codecrafters-io/shell-starter-go/internal/history"
 )
 
 var History *history.History
 
-func HandleHistoryCmd(args []string) (string, error) {
+const historyUsage = "history: usage: history [-c] [-d offset] [n] or history -anrw [filename] or history -ps arg [arg...]\n" +
+	"       or history [--cwd dir] [--failed] [--since time] [--grep regex] [--session] [n]"
+
+// HandleHistoryCmd runs the history builtin, dir is the working directory of the shell.
+func HandleHistoryCmd(args []string, dir string) (string, error) {
+	if len(args) >= 1 && strings.HasPrefix(args[0], "--") {
+		return queryHistory(args, dir)
+	}
 	if len(args) >= 1 {
 		tmp, err := HistoryCmdWithArgs(args)
 		if err != nil {
@@ -26,17 +34,55 @@ func HandleHistoryCmd(args []string) (string, error) {
 func HistoryCmdWithArgs(args []string) (string, error) {
 	n, err := strconv.Atoi(args[0])
 	if err != nil {
-		if len(args) < 2 {
+		switch args[0] {
+		case "-c":
+			History.Clear()
+			return "", nil
+		case "-d":
+			if len(args) < 2 {
+				return "", fmt.Errorf("history: -d: option requires an argument\n%s", historyUsage)
+			}
+			return "", deleteHistory(args[1])
+		case "-s":
+			// the history -s command itself is replaced by the args
+			if !History.LastIgnored {
+				History.Delete(History.Last())
+			}
+			History.PushBackOneLine(strings.Join(args[1:], " "), true)
+			return "", nil
+		case "-p":
+			return expandHistory(args[1:])
+		}
+
+		switch args[0] {
+		case "-r", "-n", "-w", "-a":
+		default:
+			if strings.HasPrefix(args[0], "-") {
+				return "", fmt.Errorf("history: %s: invalid option\n%s", args[0], historyUsage)
+			}
+			return "", fmt.Errorf("history: %s: numeric argument required", args[0])
+		}
+
+		filename := History.File()
+		if len(args) >= 2 {
+			filename = args[1]
+		}
+		if filename == "" {
 			return "", fmt.Errorf("incorrect input: missing file")
 		}
 		switch args[0] {
 		case "-r":
-			err := History.ReadHistoryFromFile(args[1])
+			err := History.ReadHistoryFromFile(filename)
+			if err != nil {
+				return "", err
+			}
+		case "-n":
+			err := History.ReadNewFromFile(filename)
 			if err != nil {
 				return "", err
 			}
 		case "-w":
-			err := History.WriteHistoryToFile(args[1])
+			err := History.WriteHistoryToFile(filename)
 			if err != nil {
 				if !errors.Is(err, history.HistoryIsEmpty) {
 					return "", err
@@ -45,7 +91,7 @@ func HistoryCmdWithArgs(args []string) (string, error) {
 				}
 			}
 		case "-a":
-			err := History.AppendHistoryToFile(args[1])
+			err := History.AppendHistoryToFile(filename)
 			if err != nil {
 				if !errors.Is(err, history.HistoryIsEmpty) && !errors.Is(err, history.NoNewRecords) {
 					return "", err
@@ -53,8 +99,6 @@ func HistoryCmdWithArgs(args []string) (string, error) {
 					return "", nil
 				}
 			}
-		default:
-			return "", fmt.Errorf("unknown args")
 		}
 	} else {
 		tmp, err := History.ReadHistoryLastNWithFormat(n)
@@ -66,4 +110,53 @@ func HistoryCmdWithArgs(args []string) (string, error) {
 	}
 
 	return "", nil
-}
\ No newline at end of file
+}
+
+// deleteHistory deletes the entry N or the entries start-end,
+// negative numbers count back from the end of history.
+func deleteHistory(arg string) error {
+	start, end := arg, arg
+	if i := strings.Index(arg[min(1, len(arg)):], "-"); i != -1 {
+		start, end = arg[:i+1], arg[i+2:]
+	}
+
+	from, err := historyPosition(start)
+	if err != nil {
+		return fmt.Errorf("history: %s: %v", arg, err)
+	}
+	to, err := historyPosition(end)
+	if err != nil {
+		return fmt.Errorf("history: %s: %v", arg, err)
+	}
+
+	if err := History.DeleteRange(from, to); err != nil {
+		return fmt.Errorf("history: %s: %v", arg, err)
+	}
+	return nil
+}
+
+// historyPosition converts the offset of history -d to the number of the entry.
+func historyPosition(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, history.PositionOutOfRange
+	}
+	if n < 0 {
+		n += History.Last() + 1
+	}
+	return n, nil
+}
+
+// expandHistory returns the history expansions of the args, one per line.
+func expandHistory(args []string) (string, error) {
+	lines := make([]string, 0, len(args))
+	for _, arg := range args {
+		expanded, _, err := History.Expand(arg)
+		if err != nil {
+			return "", fmt.Errorf("history: %v", err)
+		}
+		lines = append(lines, expanded)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/history"
+)
+
+// queryHistory lists the commands of the history database that match the options,
+// the last n of them if a number is given. dir is the working directory of the shell.
+func queryHistory(args []string, dir string) (string, error) {
+	q := history.Query{}
+	count := -1
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		switch name {
+		case "--failed":
+			q.Failed = true
+			continue
+		case "--session":
+			q.Session = History.Session
+			continue
+		case "--cwd", "--since", "--grep":
+		default:
+			if n, err := strconv.Atoi(args[i]); err == nil && n >= 0 && count < 0 {
+				count = n
+				continue
+			}
+			if strings.HasPrefix(args[i], "-") {
+				return "", fmt.Errorf("history: %s: invalid option\n%s", args[i], historyUsage)
+			}
+			return "", fmt.Errorf("history: %s: numeric argument required", args[i])
+		}
+
+		if !hasValue {
+			if i + 1 == len(args) {
+				return "", fmt.Errorf("history: %s: option requires an argument\n%s", name, historyUsage)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch name {
+		case "--cwd":
+			if !filepath.IsAbs(value) {
+				value = filepath.Join(dir, value)
+			}
+			q.Cwd = value
+		case "--since":
+			age, err := parseAge(value)
+			if err != nil {
+				return "", fmt.Errorf("history: %s: invalid time", value)
+			}
+			q.Since = time.Now().Add(-age)
+		case "--grep":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return "", fmt.Errorf("history: %s: %v", value, err)
+			}
+			q.Grep = re
+		}
+	}
+
+	if History.DB == "" {
+		return "", fmt.Errorf("history: no history database, HISTFILE is not set")
+	}
+	entries, err := history.ReadEntries(History.DB, q)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("history: %v", err)
+	}
+	if count >= 0 && count < len(entries) {
+		entries = entries[len(entries)-count:]
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s  %3d  %8s  %s  %s",
+			e.Start.Format("2006-01-02 15:04:05"), e.Status, e.Duration.Round(time.Millisecond), e.Cwd, e.Command))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseAge parses the time of --since, a duration like 90m or 1h30m, or a number of days or weeks like 7d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty time")
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[s[len(s)-1]]; ok && len(s) > 1 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number")
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid duration")
+	}
+	return age, nil
+}
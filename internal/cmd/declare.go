@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+)
+
+// attribute letters in the order declare -p prints them
+const attrLetters = "aAinrxlu"
+
+// declareOpts are the options of declare and the other declaration builtins.
+type declareOpts struct {
+	on, off   string		// attributes turned on with -x and off with +x
+	print 	  bool			// -p
+	global 	  bool			// -g, create global variables in functions
+	funcs 	  bool			// -f, functions instead of variables
+	funcNames bool			// -F, only the names of functions
+}
+
+// options the declaration builtins accept, besides the attribute letters of declare
+var declareUsage = map[string]struct{ letters, usage string }{
+	"declare":  {"aAfFgilnprux", "declare [-aAfFgilnrux] [-p] [name[=value] ...]"},
+	"typeset":  {"aAfFgilnprux", "typeset [-aAfFgilnrux] [-p] name[=value] ..."},
+	"local":    {"aAilnrux", "local [option] name[=value] ..."},
+	"readonly": {"aAfp", "readonly [-aAf] [name[=value] ...] or readonly -p"},
+	"export":   {"fnp", "export [-fn] [name[=value] ...] or export -p"},
+}
+
+// parseDeclareOpts parses the options before the names.
+func (cc *CurrentCmd) parseDeclareOpts() (declareOpts, int, error) {
+	opts := declareOpts{}
+	accepted := declareUsage[cc.Cmd]
+
+	switch cc.Cmd {
+	case "readonly":
+		opts.on, opts.global = "r", true
+	case "export":
+		opts.on, opts.global = "x", true
+	}
+
+	i := 0
+	for ; i < len(cc.Args); i++ {
+		arg := cc.Args[i]
+		if arg == "--" {
+			i++
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+
+		for _, opt := range arg[1:] {
+			if !strings.ContainsRune(accepted.letters, opt) {
+				fmt.Fprintf(cc.Stderr, "%s: %c%c: invalid option\n", cc.Cmd, arg[0], opt)
+				fmt.Fprintf(cc.Stderr, "%s: usage: %s\n", cc.Cmd, accepted.usage)
+				return opts, 0, &StatusError{Code: 2}
+			}
+
+			switch {
+			case opt == 'p':
+				opts.print = true
+			case opt == 'g':
+				opts.global = true
+			case opt == 'f':
+				opts.funcs = true
+			case opt == 'F':
+				opts.funcs, opts.funcNames = true, true
+			case opt == 'n' && cc.Cmd == "export":
+				opts.on, opts.off = "", "x"
+			case arg[0] == '+':
+				opts.off += string(opt)
+			default:
+				opts.on += string(opt)
+			}
+		}
+	}
+
+	return opts, i, nil
+}
+
+// declare sets attributes and values of variables, without names it prints them.
+// It is also typeset, local, readonly and export, which have fewer options.
+func (cc *CurrentCmd) declare() error {
+	opts, i, err := cc.parseDeclareOpts()
+	if err != nil {
+		return err
+	}
+	args := cc.Args[i:]
+
+	local := cc.Cmd == "local" || !opts.global && (cc.Cmd == "declare" || cc.Cmd == "typeset")
+	if cc.Cmd == "local" && !cc.Shell.InFunction() {
+		return fmt.Errorf("%s: can only be used in a function", cc.Cmd)
+	}
+
+	if opts.funcs {
+		return cc.declareFuncs(opts, args)
+	}
+	if len(args) == 0 {
+		cc.printVars(opts)
+		return nil
+	}
+
+	failed := false
+	for _, arg := range args {
+		var err error
+		if opts.print {
+			err = cc.printVar(arg)
+		} else {
+			err = cc.declareVar(opts, arg, i, local && cc.Shell.InFunction())
+		}
+		if err != nil {
+			fmt.Fprintf(cc.Stderr, "%s: %v\n", cc.Cmd, err)
+			failed = true
+		}
+		i++
+	}
+
+	if failed {
+		return &StatusError{Code: 1}
+	}
+	return nil
+}
+
+// declareVar runs name, name=value or name=(...) with the attributes of opts.
+// i is the index of the argument in cc.Args.
+func (cc *CurrentCmd) declareVar(opts declareOpts, arg string, i int, local bool) error {
+	name, value, appendTo, hasValue := parser.SplitAssign(arg)
+	if !hasValue {
+		name = arg
+	}
+	base, _, _ := state.SplitSubscript(name)
+	if !parser.IsName(base) {
+		return fmt.Errorf("`%s': not a valid identifier", arg)
+	}
+
+	sh := cc.Shell
+	if local {
+		if err := sh.Local(base); err != nil {
+			return err
+		}
+	}
+
+	v, ok := sh.Vars[base]
+	if !ok {
+		v = &state.Var{Unset: true}
+	}
+	if v.ReadOnly && (hasValue || strings.Contains(opts.off, "r") || strings.ContainsAny(opts.on, "aAilnu")) {
+		return fmt.Errorf("%s: readonly variable", base)
+	}
+
+	if err := setAttrs(v, ok && !v.Unset, opts); err != nil {
+		return fmt.Errorf("%s: %v", base, err)
+	}
+	sh.Vars[base] = v
+
+	elems, compound := cc.Arrays[i]
+	switch {
+	case !hasValue:
+	case v.NameRef:
+		if !parser.IsName(value) {
+			return fmt.Errorf("`%s': invalid variable name for name reference", value)
+		}
+		v.Value, v.Unset = value, false
+	case compound:
+		if err := sh.AssignArray(base, elems, appendTo); err != nil {
+			return err
+		}
+	case appendTo:
+		if err := sh.Append(name, value); err != nil {
+			return err
+		}
+	default:
+		if err := sh.Set(name, value); err != nil {
+			return err
+		}
+	}
+
+	if strings.Contains(opts.on, "r") {
+		v.ReadOnly = true
+	}
+	return nil
+}
+
+// setAttrs turns the attributes of opts on and off, except readonly which is set after the value.
+// set is false for a new variable.
+func setAttrs(v *state.Var, set bool, opts declareOpts) error {
+	for _, attr := range opts.on {
+		switch attr {
+		case 'a':
+			if v.Assoc != nil {
+				return fmt.Errorf("cannot convert associative to indexed array")
+			}
+			if v.Array == nil {
+				v.Array = make(map[int]string)
+				if set && !v.NameRef {
+					v.Array[0] = v.Value
+				}
+				v.Value = ""
+			}
+		case 'A':
+			if v.Array != nil {
+				return fmt.Errorf("cannot convert indexed to associative array")
+			}
+			if v.Assoc == nil {
+				v.Assoc = make(map[string]string)
+				if set && v.Value != "" {
+					v.Assoc["0"] = v.Value
+				}
+				v.Value = ""
+			}
+		case 'i':
+			v.Integer = true
+		case 'l':
+			v.Lower, v.Upper = true, false
+		case 'u':
+			v.Upper, v.Lower = true, false
+		case 'n':
+			v.NameRef = true
+		case 'x':
+			v.Exported = true
+		}
+	}
+
+	for _, attr := range opts.off {
+		switch attr {
+		case 'a', 'A':
+			return fmt.Errorf("cannot destroy array variables in this way")
+		case 'i':
+			v.Integer = false
+		case 'l':
+			v.Lower = false
+		case 'u':
+			v.Upper = false
+		case 'n':
+			v.NameRef = false
+		case 'x':
+			v.Exported = false
+		case 'r':
+			if v.ReadOnly {
+				return fmt.Errorf("readonly variable")
+			}
+		}
+	}
+	return nil
+}
+
+// printVars prints the variables that have all the attributes of opts, like declare -p.
+func (cc *CurrentCmd) printVars(opts declareOpts) {
+	names := make([]string, 0, len(cc.Shell.Vars))
+	for name, v := range cc.Shell.Vars {
+		if strings.Trim(opts.on, attrs(v)) != "" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if cc.Cmd == "declare" && opts.on == "" && !opts.print {
+			// declare without options prints the variables like set
+			value, ok := cc.Shell.Get(name)
+			if !ok {
+				fmt.Fprintln(cc.Stdout, name)
+				continue
+			}
+			fmt.Fprintf(cc.Stdout, "%s=%s\n", name, QuoteValue(value))
+			continue
+		}
+		fmt.Fprintln(cc.Stdout, declaration(name, cc.Shell.Vars[name]))
+	}
+}
+
+// printVar prints the variable as declare -p name.
+func (cc *CurrentCmd) printVar(name string) error {
+	v, ok := cc.Shell.Vars[name]
+	if !ok {
+		return fmt.Errorf("%s: not found", name)
+	}
+	_, err := fmt.Fprintln(cc.Stdout, declaration(name, v))
+	return err
+}
+
+// attrs returns the attribute letters of the variable.
+func attrs(v *state.Var) string {
+	has := map[byte]bool{
+		'a': v.Array != nil, 'A': v.Assoc != nil, 'i': v.Integer, 'n': v.NameRef,
+		'r': v.ReadOnly, 'x': v.Exported, 'l': v.Lower, 'u': v.Upper,
+	}
+
+	letters := ""
+	for i := 0; i < len(attrLetters); i++ {
+		if has[attrLetters[i]] {
+			letters += attrLetters[i:i+1]
+		}
+	}
+	return letters
+}
+
+// declaration returns the declare command that creates the variable again.
+func declaration(name string, v *state.Var) string {
+	letters := attrs(v)
+	if letters == "" {
+		letters = "-"
+	}
+	buf := strings.Builder{}
+	fmt.Fprintf(&buf, "declare -%s %s", letters, name)
+
+	switch {
+	case v.Unset:
+	case v.Array != nil:
+		indexes := make([]int, 0, len(v.Array))
+		for i := range v.Array {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+
+		buf.WriteString("=(")
+		for i, index := range indexes {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			fmt.Fprintf(&buf, "[%d]=%s", index, doubleQuote(v.Array[index]))
+		}
+		buf.WriteString(")")
+	case v.Assoc != nil:
+		keys := make([]string, 0, len(v.Assoc))
+		for key := range v.Assoc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("=(")
+		for _, key := range keys {
+			quoted := key
+			if QuoteValue(key) != key {
+				quoted = doubleQuote(key)
+			}
+			fmt.Fprintf(&buf, "[%s]=%s ", quoted, doubleQuote(v.Assoc[key]))
+		}
+		buf.WriteString(")")
+	default:
+		buf.WriteString("=" + doubleQuote(v.Value))
+	}
+
+	return buf.String()
+}
+
+// doubleQuote quotes the value in double quotes, escaping the characters special in them.
+func doubleQuote(value string) string {
+	buf := strings.Builder{}
+	buf.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte("\"$`\\", value[i]) != -1 {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(value[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// declareFuncs prints the functions with -f, or only their names with -F.
+func (cc *CurrentCmd) declareFuncs(opts declareOpts, names []string) error {
+	all := len(names) == 0
+	if all {
+		for name := range cc.Shell.Funcs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	failed := false
+	for _, name := range names {
+		fn, ok := cc.Shell.Funcs[name]
+		switch {
+		case !ok:
+			if cc.Cmd == "export" || cc.Cmd == "readonly" {
+				fmt.Fprintf(cc.Stderr, "%s: %s: not a function\n", cc.Cmd, name)
+			}
+			failed = true
+		case cc.Cmd == "export" || cc.Cmd == "readonly":
+			// functions have no attributes in this shell
+		case opts.funcNames && all:
+			fmt.Fprintf(cc.Stdout, "declare -f %s\n", name)
+		case opts.funcNames:
+			fmt.Fprintln(cc.Stdout, name)
+		default:
+			fmt.Fprintln(cc.Stdout, fn.Src)
+		}
+	}
+
+	if failed {
+		return &StatusError{Code: 1}
+	}
+	return nil
+}
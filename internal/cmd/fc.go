@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd/commands"
+)
+
+const fcUsage = "fc [-e ename] [-lnr] [first] [last] or fc -s [pat=rep] [command]"
+
+// commands listed by fc -l without a range
+const fcListCount = 16
+
+// fc lists, edits and runs again commands of history.
+func (cc *CurrentCmd) fc() error {
+	// -5 is an operand, not an option
+	cut := len(cc.Args)
+	for i, arg := range cc.Args {
+		if len(arg) > 1 && arg[0] == '-' && isDigits(arg[1:]) {
+			cut = i
+			break
+		}
+	}
+	optsCmd := *cc
+	optsCmd.Args = cc.Args[:cut]
+	opts, args, err := optsCmd.parseOpts("e:lnrs", fcUsage)
+	if err != nil {
+		return err
+	}
+	args = append(args, cc.Args[cut:]...)
+
+	if commands.History == nil {
+		return fmt.Errorf("%s: no command found", cc.Cmd)
+	}
+	// the line with fc itself is not one of the commands
+	entries := commands.History.ReadFromHead()
+	// numbers of the commands dropped for HISTSIZE are not used again
+	base := commands.History.Last() - len(entries)
+	if len(entries) > 0 && !commands.History.LastIgnored {
+		entries = entries[:len(entries)-1]
+	}
+
+	editor, hasEditor := opts['e']
+	if _, ok := opts['s']; ok || hasEditor && editor == "-" {
+		return cc.fcRerun(entries, base, args)
+	}
+
+	_, list := opts['l']
+	first, last := -1, -1
+	if list {
+		first = -fcListCount
+	}
+	if len(args) > 0 {
+		if first, err = cc.fcEntry(entries, base, args[0]); err != nil {
+			return err
+		}
+		if !list {
+			last = first
+		}
+	}
+	if len(args) > 1 {
+		if last, err = cc.fcEntry(entries, base, args[1]); err != nil {
+			return err
+		}
+	}
+	first, last = fcNumber(entries, first), fcNumber(entries, last)
+	if len(entries) == 0 {
+		return fmt.Errorf("%s: history specification out of range", cc.Cmd)
+	}
+
+	_, reverse := opts['r']
+	if first > last {
+		first, last = last, first
+		reverse = !reverse
+	}
+
+	numbers := make([]int, 0, last - first + 1)
+	for n := first; n <= last; n++ {
+		numbers = append(numbers, n)
+	}
+	if reverse {
+		for i, j := 0, len(numbers)-1; i < j; i, j = i+1, j-1 {
+			numbers[i], numbers[j] = numbers[j], numbers[i]
+		}
+	}
+
+	if list {
+		_, noNumbers := opts['n']
+		for _, n := range numbers {
+			if noNumbers {
+				fmt.Fprintf(cc.Stdout, "\t %s\n", entries[n-1])
+			} else {
+				fmt.Fprintf(cc.Stdout, "%d\t %s\n", base + n, entries[n-1])
+			}
+		}
+		return nil
+	}
+
+	lines := make([]string, len(numbers))
+	for i, n := range numbers {
+		lines[i] = entries[n-1]
+	}
+	return cc.fcEdit(editor, strings.Join(lines, "\n") + "\n")
+}
+
+// fcEdit opens the commands in the editor and runs what is saved.
+func (cc *CurrentCmd) fcEdit(editor, text string) error {
+	if editor == "" {
+		editor, _ = cc.Shell.Get("FCEDIT")
+	}
+	if editor == "" {
+		editor, _ = cc.Shell.Get("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", "fc-*.sh")
+	if err != nil {
+		return fmt.Errorf("%s: %v", cc.Cmd, err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", cc.Cmd, err)
+	}
+
+	// an editor that fails leaves the commands not run
+	if err := cc.Eval(editor + " " + QuoteValue(f.Name()), cc.Streams); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return fmt.Errorf("%s: %v", cc.Cmd, err)
+	}
+	edited := strings.TrimRight(string(data), "\n")
+	if edited == "" {
+		return nil
+	}
+
+	return cc.fcRun(edited)
+}
+
+// fcRerun runs the command again, after replacing pat by rep if the first operand is pat=rep.
+func (cc *CurrentCmd) fcRerun(entries []string, base int, args []string) error {
+	pat, rep, subst := "", "", false
+	if len(args) > 0 && strings.Contains(args[0], "=") {
+		pat, rep, _ = strings.Cut(args[0], "=")
+		subst = pat != ""
+		args = args[1:]
+	}
+
+	n := -1
+	if len(args) > 0 {
+		var err error
+		if n, err = cc.fcEntry(entries, base, args[0]); err != nil {
+			return err
+		}
+	}
+	n = fcNumber(entries, n)
+	if len(entries) == 0 {
+		return fmt.Errorf("%s: no command found", cc.Cmd)
+	}
+
+	command := entries[n-1]
+	if subst {
+		command = strings.ReplaceAll(command, pat, rep)
+	}
+
+	return cc.fcRun(command)
+}
+
+// fcRun shows the commands and runs them, in history they take the place of the fc command.
+func (cc *CurrentCmd) fcRun(command string) error {
+	fmt.Fprintln(cc.Stdout, command)
+
+	if !commands.History.LastIgnored {
+		commands.History.Delete(commands.History.Last())
+	}
+	commands.History.PushBackOneLine(command, true)
+
+	return cc.Eval(command + "\n", cc.Streams)
+}
+
+// fcEntry finds the command by the number, negative counting back from the last one,
+// or by the start of the command. Returns its position in entries from 1, maybe out of range.
+func (cc *CurrentCmd) fcEntry(entries []string, base int, spec string) (int, error) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		switch {
+		case n == 0:
+			n = -1
+		case n > 0:
+			n = max(1, n - base)
+		}
+		return n, nil
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(entries[i], spec) {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%s: no command found", cc.Cmd)
+}
+
+// fcNumber converts a negative number to the number of the command
+// and moves one that is out of range to the first or the last command.
+func fcNumber(entries []string, n int) int {
+	if n < 0 {
+		n += len(entries) + 1
+	}
+	return max(1, min(n, len(entries)))
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import "fmt"
+
+// Builtins that change the flow of execution return these errors,
+// they go up to the loop or to the shell that has to handle them.
+
+type BreakError struct {
+	N int
+}
+
+func (e *BreakError) Error() string {
+	return fmt.Sprintf("break %d", e.N)
+}
+
+type ContinueError struct {
+	N int
+}
+
+func (e *ContinueError) Error() string {
+	return fmt.Sprintf("continue %d", e.N)
+}
+
+// AbortError ends the commands of the line that is running, but not the shell.
+type AbortError struct {
+	Code int
+}
+
+func (e *AbortError) Error() string {
+	return fmt.Sprintf("abort %d", e.Code)
+}
+
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit %d", e.Code)
+}
+
+// StatusError ends a builtin with the exit status Code without any message.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ReturnError ends the running function with the exit status Code.
+type ReturnError struct {
+	Code int
+}
+
+func (e *ReturnError) Error() string {
+	return fmt.Sprintf("return %d", e.Code)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+)
+
+// returnCmd ends the function with the status of the argument or of the last command.
+func (cc *CurrentCmd) returnCmd() error {
+	if !cc.Shell.InFunction() {
+		return fmt.Errorf("%s: can only `return' from a function or sourced script", cc.Cmd)
+	}
+
+	code := cc.Shell.Status
+	if len(cc.Args) > 0 {
+		n, err := strconv.Atoi(cc.Args[0])
+		if err != nil {
+			fmt.Fprintf(cc.Stderr, "%s: %s: numeric argument required\n", cc.Cmd, cc.Args[0])
+			n = 2
+		}
+		code = n
+	}
+
+	return &ReturnError{Code: code & 0xff}
+}
+
+// unset removes variables with -v and functions with -f,
+// without options a variable or else a function with the name.
+func (cc *CurrentCmd) unset() error {
+	onlyVars, onlyFuncs := false, false
+
+	args := cc.Args
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") && len(args[0]) > 1 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		for _, opt := range args[0][1:] {
+			switch opt {
+			case 'v':
+				onlyVars = true
+			case 'f':
+				onlyFuncs = true
+			default:
+				fmt.Fprintf(cc.Stderr, "%s: -%c: invalid option\n", cc.Cmd, opt)
+				fmt.Fprintf(cc.Stderr, "%s: usage: unset [-f] [-v] [name ...]\n", cc.Cmd)
+				return &StatusError{Code: 2}
+			}
+		}
+		args = args[1:]
+	}
+
+	failed := false
+	for _, name := range args {
+		if onlyFuncs {
+			delete(cc.Shell.Funcs, name)
+			continue
+		}
+
+		base, _, _ := state.SplitSubscript(name)
+		if !parser.IsName(base) {
+			fmt.Fprintf(cc.Stderr, "%s: `%s': not a valid identifier\n", cc.Cmd, name)
+			failed = true
+			continue
+		}
+
+		if _, isVar := cc.Shell.Vars[base]; !isVar && !onlyVars {
+			delete(cc.Shell.Funcs, name)
+			continue
+		}
+		if err := cc.Shell.Unset(name); err != nil {
+			fmt.Fprintf(cc.Stderr, "%s: %v\n", cc.Cmd, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return &StatusError{Code: 1}
+	}
+	return nil
+}
+
+// caller prints the line and the file of the call of the running function,
+// with a number N the line, the function and the file of the N-th outer call.
+func (cc *CurrentCmd) caller() error {
+	frames := cc.Shell.Frames
+
+	n := 0
+	if len(cc.Args) > 0 {
+		var err error
+		n, err = strconv.Atoi(cc.Args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s: %s: invalid number", cc.Cmd, cc.Args[0])
+		}
+	}
+
+	i := len(frames) - 1 - n
+	if i < 0 {
+		return &StatusError{Code: 1}
+	}
+	frame := frames[i]
+
+	if len(cc.Args) == 0 {
+		_, err := fmt.Fprintf(cc.Stdout, "%d %s\n", frame.CallLine, frame.Source)
+		return err
+	}
+
+	caller := "main"
+	if i > 0 {
+		caller = frames[i-1].Func
+	}
+	_, err := fmt.Fprintf(cc.Stdout, "%d %s %s\n", frame.CallLine, caller, frame.Source)
+	return err
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+)
+
+// let evaluates every argument as an arithmetic expression,
+// the status is 0 if the last value is not zero.
+func (cc *CurrentCmd) let() error {
+	if len(cc.Args) == 0 {
+		return fmt.Errorf("%s: expression expected", cc.Cmd)
+	}
+
+	var n int64
+	for _, expr := range cc.Args {
+		var err error
+		n, err = arith.Eval(expr, cc.Shell)
+		if err != nil {
+			return fmt.Errorf("%s: %v", cc.Cmd, err)
+		}
+	}
+
+	if n == 0 {
+		return &StatusError{Code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// mapfile reads lines of the standard input into an indexed array, MAPFILE by default.
+func (cc *CurrentCmd) mapfile() error {
+	opts, args, err := cc.parseOpts("td:n:s:O:", cc.Cmd + " [-d delim] [-n count] [-O origin] [-s count] [-t] [array]")
+	if err != nil {
+		return err
+	}
+
+	name := "MAPFILE"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if !parser.IsName(name) {
+		return fmt.Errorf("%s: `%s': not a valid identifier", cc.Cmd, name)
+	}
+
+	delim := byte('\n')
+	if d, ok := opts['d']; ok {
+		delim = 0
+		if d != "" {
+			delim = d[0]
+		}
+	}
+
+	numbers := map[byte]int{}
+	for _, opt := range []byte("nsO") {
+		if arg, ok := opts[opt]; ok {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s: %s: invalid number", cc.Cmd, arg)
+			}
+			numbers[opt] = n
+		}
+	}
+	count, skip, origin := numbers['n'], numbers['s'], numbers['O']
+
+	// without an origin the array is emptied first
+	if _, ok := opts['O']; !ok {
+		if err := cc.Shell.InitArray(name, false); err != nil {
+			return fmt.Errorf("%s: %v", cc.Cmd, err)
+		}
+	}
+
+	for read := 0; count == 0 || read < count + skip; read++ {
+		line, err := readUntil(cc.Stdin, delim)
+		if line == "" && err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("%s: %v", cc.Cmd, err)
+		}
+		if read < skip {
+			continue
+		}
+
+		if _, ok := opts['t']; ok && line[len(line)-1] == delim {
+			line = line[:len(line)-1]
+		}
+		if err := cc.Shell.Set(fmt.Sprintf("%s[%d]", name, origin), line); err != nil {
+			return fmt.Errorf("%s: %v", cc.Cmd, err)
+		}
+		origin++
+	}
+
+	return nil
+}
+
+// readUntil reads up to and including the delimiter, a byte at a time
+// so that nothing after it is taken from the input of the next commands.
+func readUntil(r io.Reader, delim byte) (string, error) {
+	buf := []byte{}
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			buf = append(buf, b[0])
+			if b[0] == delim {
+				return string(buf), nil
+			}
+		}
+		if err != nil {
+			return string(buf), err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseOpts parses the options of a builtin before its operands.
+// In spec a letter followed by : takes an argument, like -n 3 or -n3.
+// Returns the options by letter, "" for those without argument, and the operands.
+func (cc *CurrentCmd) parseOpts(spec, usage string) (map[byte]string, []string, error) {
+	opts := make(map[byte]string)
+
+	args := cc.Args
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			opt := arg[i]
+			at := strings.IndexByte(spec, opt)
+			if at == -1 || opt == ':' {
+				fmt.Fprintf(cc.Stderr, "%s: -%c: invalid option\n", cc.Cmd, opt)
+				fmt.Fprintf(cc.Stderr, "%s: usage: %s\n", cc.Cmd, usage)
+				return nil, nil, &StatusError{Code: 2}
+			}
+			if at + 1 == len(spec) || spec[at+1] != ':' {
+				opts[opt] = ""
+				continue
+			}
+
+			switch {
+			case i + 1 < len(arg):
+				opts[opt] = arg[i+1:]
+			case len(args) > 0:
+				opts[opt] = args[0]
+				args = args[1:]
+			default:
+				fmt.Fprintf(cc.Stderr, "%s: -%c: option requires an argument\n", cc.Cmd, opt)
+				fmt.Fprintf(cc.Stderr, "%s: usage: %s\n", cc.Cmd, usage)
+				return nil, nil, &StatusError{Code: 2}
+			}
+			break
+		}
+	}
+
+	return opts, args, nil
+}
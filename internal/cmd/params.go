@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+)
+
+// shift removes the first n positional parameters, 1 by default.
+func (cc *CurrentCmd) shift() error {
+	n := 1
+	if len(cc.Args) > 0 {
+		var err error
+		n, err = strconv.Atoi(cc.Args[0])
+		if err != nil {
+			return fmt.Errorf("%s: %s: numeric argument required", cc.Cmd, cc.Args[0])
+		}
+		if n < 0 {
+			return fmt.Errorf("%s: %s: shift count out of range", cc.Cmd, cc.Args[0])
+		}
+	}
+
+	if n > len(cc.Shell.Params) {
+		return &StatusError{Code: 1}
+	}
+	cc.Shell.Params = cc.Shell.Params[n:]
+
+	return nil
+}
+
+// set without arguments prints the variables. Options -x and +x turn shell options on and off,
+// -o name and +o name by their names, and the other arguments replace the positional parameters.
+func (cc *CurrentCmd) set() error {
+	if len(cc.Args) == 0 {
+		names := make([]string, 0, len(cc.Shell.Vars))
+		for name := range cc.Shell.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value, _ := cc.Shell.Get(name)
+			fmt.Fprintf(cc.Stdout, "%s=%s\n", name, QuoteValue(value))
+		}
+		return nil
+	}
+
+	args := cc.Args
+	setParams := false
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			args, setParams = args[1:], true
+			break
+		}
+		// - ends the options and turns off -x and -v
+		if arg == "-" {
+			cc.Shell.SetOption("xtrace", false)
+			cc.Shell.SetOption("verbose", false)
+			args = args[1:]
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' && arg[0] != '+' {
+			break
+		}
+		args = args[1:]
+
+		on := arg[0] == '-'
+		for i := 1; i < len(arg); i++ {
+			if arg[i] == 'o' {
+				if len(args) == 0 {
+					cc.printOptions(on)
+					continue
+				}
+				if err := cc.Shell.SetOption(args[0], on); err != nil {
+					fmt.Fprintf(cc.Stderr, "%s: %v\n", cc.Cmd, err)
+					return &StatusError{Code: 2}
+				}
+				args = args[1:]
+				continue
+			}
+
+			name, ok := state.OptionByFlag(arg[i])
+			if !ok {
+				fmt.Fprintf(cc.Stderr, "%s: %c%c: invalid option\n", cc.Cmd, arg[0], arg[i])
+				fmt.Fprintf(cc.Stderr, "%s: usage: set [-efuvxH] [-o option-name] [--] [arg ...]\n", cc.Cmd)
+				return &StatusError{Code: 2}
+			}
+			cc.Shell.SetOption(name, on)
+		}
+	}
+
+	if len(args) > 0 || setParams {
+		cc.Shell.Params = append([]string{}, args...)
+	}
+	return nil
+}
+
+// printOptions prints the options for set -o, or for set +o as the commands that set them again.
+func (cc *CurrentCmd) printOptions(table bool) {
+	for _, opt := range state.Options {
+		on := cc.Shell.Option(opt.Name)
+		switch {
+		case table && on:
+			fmt.Fprintf(cc.Stdout, "%-15s\ton\n", opt.Name)
+		case table:
+			fmt.Fprintf(cc.Stdout, "%-15s\toff\n", opt.Name)
+		case on:
+			fmt.Fprintf(cc.Stdout, "set -o %s\n", opt.Name)
+		default:
+			fmt.Fprintf(cc.Stdout, "set +o %s\n", opt.Name)
+		}
+	}
+}
+
+// QuoteValue quotes the value so that it can be read back by the shell.
+func QuoteValue(value string) string {
+	if value != "" && strings.IndexFunc(value, func(r rune) bool {
+		return !(r == '_' || r == '/' || r == '.' || r == '-' || r == ':' || r == ',' || r == '+' || r == '=' || r == '@' || r == '%' ||
+			'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) == -1 {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/term"
+)
+
+// Terminal reads lines from the terminal of the interactive shell, nil otherwise.
+// The line editor owns the terminal, so read asks it for lines instead of reading the terminal itself.
+var Terminal interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// the status of read when the timeout passes, like being killed by SIGALRM
+const readTimeoutStatus = 142
+
+// readOpts are the options of read.
+type readOpts struct {
+	raw 	 bool			// -r, backslash does not escape
+	silent 	 bool			// -s, the typed characters are not echoed
+	prompt 	 string			// -p, printed if the input is a terminal
+	nchars 	 int			// -n, return after so many characters, 0 for no limit
+	delim 	 byte			// -d, the first character of the argument ends the input instead of newline
+	deadline time.Time		// -t
+	array 	 string			// -a, the fields are assigned to the array
+}
+
+// read reads a line of the standard input and assigns its fields split on IFS to the names,
+// the last name gets the rest of the line. Without names the line is assigned to REPLY.
+func (cc *CurrentCmd) read() error {
+	opts, names, err := cc.parseReadOpts()
+	if err != nil {
+		return err
+	}
+	for _, name := range append(names, opts.array) {
+		if name != "" && !parser.IsName(name) {
+			return fmt.Errorf("%s: `%s': not a valid identifier", cc.Cmd, name)
+		}
+	}
+
+	fd := -1
+	if f, ok := cc.Stdin.(*os.File); ok {
+		fd = int(f.Fd())
+	}
+	tty := fd != -1 && term.IsTerminal(fd)
+
+	// -t 0 only checks whether there is input
+	if !opts.deadline.IsZero() && !opts.deadline.After(time.Now()) {
+		if fd == -1 || term.Wait(fd, opts.deadline) == nil {
+			return nil
+		}
+		return &StatusError{Code: 1}
+	}
+
+	var line []byte
+	var escaped []bool
+	if tty && Terminal != nil && cc.Stdin == os.Stdin && !opts.silent && opts.nchars == 0 && opts.delim == '\n' && opts.deadline.IsZero() {
+		line, escaped, err = cc.readTerminal(opts)
+	} else {
+		if tty {
+			fmt.Fprint(cc.Stderr, opts.prompt)
+			if opts.silent || opts.nchars > 0 {
+				if restore, errMode := term.Mode(fd, !opts.silent, opts.nchars == 0); errMode == nil {
+					defer restore()
+				}
+			}
+		}
+		line, escaped, err = readInput(&inputReader{r: cc.Stdin, fd: fd, deadline: opts.deadline}, opts)
+	}
+
+	if assignErr := cc.assignRead(opts, names, line, escaped); assignErr != nil {
+		return fmt.Errorf("%s: %v", cc.Cmd, assignErr)
+	}
+
+	switch {
+	case errors.Is(err, term.ErrTimeout):
+		return &StatusError{Code: readTimeoutStatus}
+	case errors.Is(err, io.EOF):
+		return &StatusError{Code: 1}
+	case err != nil:
+		return fmt.Errorf("%s: %v", cc.Cmd, err)
+	}
+	return nil
+}
+
+func (cc *CurrentCmd) parseReadOpts() (readOpts, []string, error) {
+	args, names, err := cc.parseOpts("rsp:n:d:t:a:", "read [-rs] [-a array] [-d delim] [-n nchars] [-p prompt] [-t timeout] [name ...]")
+	if err != nil {
+		return readOpts{}, nil, err
+	}
+
+	opts := readOpts{prompt: args['p'], array: args['a'], delim: '\n'}
+	_, opts.raw = args['r']
+	_, opts.silent = args['s']
+
+	if d, ok := args['d']; ok {
+		opts.delim = 0
+		if d != "" {
+			opts.delim = d[0]
+		}
+	}
+	if n, ok := args['n']; ok {
+		if opts.nchars, err = strconv.Atoi(n); err != nil || opts.nchars < 0 {
+			return opts, nil, fmt.Errorf("%s: %s: invalid number", cc.Cmd, n)
+		}
+	}
+	if t, ok := args['t']; ok {
+		seconds, err := strconv.ParseFloat(t, 64)
+		if err != nil || seconds < 0 {
+			return opts, nil, fmt.Errorf("%s: %s: invalid timeout specification", cc.Cmd, t)
+		}
+		opts.deadline = time.Now().Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	return opts, names, nil
+}
+
+// readTerminal reads the line with the line editor, lines ending with a backslash continue on the next one.
+func (cc *CurrentCmd) readTerminal(opts readOpts) ([]byte, []bool, error) {
+	line, escaped := []byte{}, []bool{}
+
+	prompt := opts.prompt
+	for {
+		text, err := Terminal.ReadLine(prompt)
+		if err != nil {
+			return line, escaped, io.EOF
+		}
+		prompt = ""
+
+		text += "\n"
+		input := &inputReader{r: strings.NewReader(text), fd: -1}
+		more, moreEscaped, err := readInput(input, opts)
+		line, escaped = append(line, more...), append(escaped, moreEscaped...)
+
+		// the newline was escaped, which continues the line
+		if !errors.Is(err, io.EOF) {
+			return line, escaped, nil
+		}
+	}
+}
+
+// inputReader reads the input of read a byte at a time, so that nothing after the line
+// is taken from the next commands.
+type inputReader struct {
+	r 		 io.Reader
+	fd 		 int				// descriptor of r or -1, for the deadline
+	deadline time.Time
+}
+
+func (ir *inputReader) readByte() (byte, error) {
+	if ir.fd != -1 {
+		if err := term.Wait(ir.fd, ir.deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	b := make([]byte, 1)
+	for {
+		n, err := ir.r.Read(b)
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readInput reads up to the delimiter, which is not included.
+// Without -r a backslash escapes the next character, and removes an escaped newline.
+// Returns the bytes and which of them were escaped.
+func readInput(ir *inputReader, opts readOpts) ([]byte, []bool, error) {
+	line, escaped := []byte{}, []bool{}
+
+	chars, lastChar := 0, 0
+	escape := false
+	for opts.nchars == 0 || chars < opts.nchars || !utf8.FullRune(line[lastChar:]) {
+		b, err := ir.readByte()
+		if err != nil {
+			return line, escaped, err
+		}
+
+		isEscaped := false
+		switch {
+		case escape:
+			escape = false
+			if b == '\n' {
+				continue
+			}
+			isEscaped = true
+		case b == '\\' && !opts.raw:
+			escape = true
+			continue
+		case b == opts.delim:
+			return line, escaped, nil
+		}
+
+		if utf8.RuneStart(b) {
+			chars++
+			lastChar = len(line)
+		}
+		line = append(line, b)
+		escaped = append(escaped, isEscaped)
+	}
+
+	return line, escaped, nil
+}
+
+// assignRead assigns the fields of the line to the names, to the array of -a or to REPLY.
+func (cc *CurrentCmd) assignRead(opts readOpts, names []string, line []byte, escaped []bool) error {
+	ifs, ok := cc.Shell.Get("IFS")
+	if !ok {
+		ifs = " \t\n"
+	}
+
+	switch {
+	case opts.array != "":
+		return cc.Shell.SetArray(opts.array, expand.Split(string(line), escaped, ifs, 0))
+	case len(names) == 0:
+		return cc.Shell.Set("REPLY", string(line))
+	}
+
+	fields := expand.Split(string(line), escaped, ifs, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(fields) {
+			value = fields[i]
+		}
+		if err := cc.Shell.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
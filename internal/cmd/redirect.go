@@ -2,72 +2,243 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+// availRedType are the redirection operators of bash. The lexer knows all of them,
+// otherwise 2>&1 would write to a file named &1 and <<EOF read one named <EOF.
+// The shell itself needs >& for |&, and <<< and << let read and mapfile take
+// their input without a pipeline, whose commands run in a subshell.
 var availRedType = map[string]bool{
+	"<":   true,
 	">":   true,
 	">>":  true,
-	"1>":  true,
-	"1>>": true,
-	"2>":  true,
-	"2>>": true,
+	">|":  true,
+	"<>":  true,
+	"<&":  true,
+	">&":  true,
+	"&>":  true,
+	"&>>": true,
+	"<<":  true,
+	"<<-": true,
+	"<<<": true,
 }
 
 // CorrectRedirectType checks the correctness of the specified redirect type.
-func (cc *CurrentCmd) CorrectRedirectType() bool {
-	if _, exist := availRedType[cc.RedirectType]; exist {
+func CorrectRedirectType(op string) bool {
+	if _, exist := availRedType[op]; exist {
 		return true
 	}
 
 	return false
 }
 
-// SetupRedirection configures where output should be redirected if a redirect was specified.
-func (cc *CurrentCmd) SetupRedirection() error {
-	if len(cc.Files) == 0 && cc.RedirectType == ""  {
+// WithRedirections returns a copy of the streams that applies rs on setup.
+func (s Streams) WithRedirections(rs []Redirection) Streams {
+	s.Redirect = Redirect{Redirections: rs, Dir: s.Dir}
+	return s
+}
+
+// SetupRedirection applies redirections in order, opening the files.
+// The streams are replaced, so a copy of the parent's streams may be redirected.
+func (s *Streams) SetupRedirection() error {
+	if len(s.Redirections) == 0 {
 		return nil
 	}
 
-	if !cc.CorrectRedirectType() {
-		return fmt.Errorf("unknown redirect type: %s", cc.RedirectType)
+	// the map may be shared with the parent
+	fds := make(map[int]*os.File, len(s.Fds))
+	for fd, f := range s.Fds {
+		fds[fd] = f
+	}
+	s.Fds = fds
+
+	for _, r := range s.Redirections {
+		if err := s.redirect(r); err != nil {
+			s.CloseFiles()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Streams) redirect(r Redirection) error {
+	if !CorrectRedirectType(r.Op) {
+		return fmt.Errorf("unknown redirect type: %s", r.Op)
+	}
+
+	fd := r.Fd
+	if fd == -1 {
+		fd = 1
+		if strings.HasPrefix(r.Op, "<") {
+			fd = 0
+		}
 	}
 
-	files := make([]*os.File, 0, len(cc.Files))
-	for _, filename := range cc.Files {
-		f, err := os.OpenFile(filename, cc.Flag, 0766)
+	switch r.Op {
+	case "<":
+		return s.openFile(fd, r.Target, os.O_RDONLY)
+	case "<>":
+		return s.openFile(fd, r.Target, os.O_CREATE | os.O_RDWR)
+	case ">", ">|":
+		return s.openFile(fd, r.Target, os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
+	case ">>":
+		return s.openFile(fd, r.Target, os.O_CREATE | os.O_WRONLY | os.O_APPEND)
+	case "&>", "&>>":
+		return s.redirectBoth(r.Op == "&>>", r.Target)
+	case "<<", "<<-", "<<<":
+		return s.hereDoc(fd, r.Target)
+	case "<&", ">&":
+		if r.Target == "-" {
+			return s.set(fd, nil)
+		}
+		srcFd, err := strconv.Atoi(r.Target)
 		if err != nil {
-			// close that already open
-			for _, opened := range files {
-				opened.Close()
+			// >&file is the same as &>file
+			if r.Op == ">&" && r.Fd == -1 {
+				return s.redirectBoth(false, r.Target)
 			}
-			return fmt.Errorf("%v\n", err)
+			return fmt.Errorf("%s: ambiguous redirect", r.Target)
+		}
+		stream, ok := s.get(srcFd)
+		if !ok {
+			return fmt.Errorf("%d: Bad file descriptor", srcFd)
 		}
-		files = append(files, f)
+		return s.set(fd, stream)
+	}
+
+	return nil
+}
+
+func (s *Streams) openFile(fd int, filename string, flag int) error {
+	name := filename
+	if s.Dir != "" && !filepath.IsAbs(name) {
+		name = filepath.Join(s.Dir, name)
+	}
+
+	f, err := os.OpenFile(name, flag, 0666)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, errorText(err))
+	}
+	s.filesToClose = append(s.filesToClose, f)
+
+	return s.set(fd, f)
+}
+
+// redirectBoth sends stdout and stderr to the file.
+func (s *Streams) redirectBoth(appendTo bool, filename string) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendTo {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
 	}
 
-	// if several files were specified, then all are opened,
-	// but the last one is written
-	lastFile := files[len(files)-1]
+	if err := s.openFile(1, filename, flag); err != nil {
+		return err
+	}
+	s.Stderr = s.Stdout
+
+	return nil
+}
+
+// hereDoc makes text readable from fd.
+func (s *Streams) hereDoc(fd int, text string) error {
+	if fd == 0 {
+		s.Stdin = strings.NewReader(text)
+		return nil
+	}
 
-	switch cc.RedirectType {
-	case "2>", "2>>":
-		cc.Stderr = lastFile
-	case ">", ">>", "1>", "1>>":
-		cc.Stdout = lastFile
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
 	}
+	s.filesToClose = append(s.filesToClose, r)
+	go func() {
+		io.WriteString(w, text)
+		w.Close()
+	}()
+
+	return s.set(fd, r)
+}
+
+// get returns the stream open on fd.
+func (s *Streams) get(fd int) (any, bool) {
+	switch fd {
+	case 0:
+		return s.Stdin, s.Stdin != nil
+	case 1:
+		return s.Stdout, s.Stdout != nil
+	case 2:
+		return s.Stderr, s.Stderr != nil
+	}
+
+	f, ok := s.Fds[fd]
+	return f, ok
+}
 
-	cc.filesToClose = files[:len(files)-1]
+// set opens stream on fd, nil closes fd.
+func (s *Streams) set(fd int, stream any) error {
+	switch fd {
+	case 0:
+		if stream == nil {
+			s.Stdin = nil
+			return nil
+		}
+		r, ok := stream.(io.Reader)
+		if !ok {
+			return fmt.Errorf("%d: Bad file descriptor", fd)
+		}
+		s.Stdin = r
+	case 1, 2:
+		var w io.Writer = io.Discard
+		if stream != nil {
+			var ok bool
+			if w, ok = stream.(io.Writer); !ok {
+				return fmt.Errorf("%d: Bad file descriptor", fd)
+			}
+		}
+		if fd == 1 {
+			s.Stdout = w
+		} else {
+			s.Stderr = w
+		}
+	default:
+		if stream == nil {
+			delete(s.Fds, fd)
+			return nil
+		}
+		f, ok := stream.(*os.File)
+		if !ok {
+			return fmt.Errorf("%d: Bad file descriptor", fd)
+		}
+		s.Fds[fd] = f
+	}
 
 	return nil
 }
 
-func (cc *CurrentCmd) CloseFiles() {
-	if cc.filesToClose != nil {
-		for _, f := range cc.filesToClose {
+// errorText returns the text of err without the operation and path, e.g. "No such file or directory".
+func errorText(err error) string {
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+	text := err.Error()
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func (s *Streams) CloseFiles() {
+	if s.filesToClose != nil {
+		for _, f := range s.filesToClose {
 			f.Close()
 		}
-		cc.filesToClose = nil
+		s.filesToClose = nil
 	}
 
-}
\ No newline at end of file
+}
@@ -1,19 +1,30 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
+	"syscall"
 
 	"github.com/codecrafters-io/shell-starter-go/internal/utils/path"
 )
 
+var ErrCommandNotFound = errors.New("command not found")
+
 func (cc *CurrentCmd) ExecOtherCommand() error {
 	cmdForRun, err := cc.BuildCmd()
 	if err != nil {
 		return err
 	}
 
-	if err := cmdForRun.Run(); err != nil {
+	cmdForRun, err = cc.start(cmdForRun)
+	if err != nil {
+		return err
+	}
+
+	if err := cmdForRun.Wait(); err != nil {
 		return fmt.Errorf("%w", err)
 	}
 
@@ -21,17 +32,71 @@ func (cc *CurrentCmd) ExecOtherCommand() error {
 }
 
 func (cc *CurrentCmd) BuildCmd() (*exec.Cmd, error) {
-	path := path.LookPath(cc.Cmd)
+	path := cc.lookPath(cc.Cmd)
 	if path == "" {
-		return nil, fmt.Errorf("%s: command not found", cc.Cmd)
+		return nil, fmt.Errorf("%s: %w", cc.Cmd, ErrCommandNotFound)
+	}
+
+	cmd := exec.Command(path, cc.Args...)
+	cmd.Args[0] = cc.Cmd
+	cc.setupExecCmd(cmd)
+
+	return cmd, nil
+}
+
+// lookPath searches for the executable name in PATH of the shell.
+func (cc *CurrentCmd) lookPath(name string) string {
+	if cc.Shell == nil {
+		return path.LookPath(name)
 	}
 
-	cmd := exec.Command(cc.Cmd, cc.Args...)
+	// a relative filename is in the working directory of the shell
+	if strings.Contains(name, "/") {
+		return path.LookPathIn(cc.Shell.Path(name), "")
+	}
+
+	pathEnv, _ := cc.Shell.Get("PATH")
+	return path.LookPathIn(name, pathEnv)
+}
+
+// setupExecCmd passes the streams and the environment of the shell to cmd.
+func (cc *CurrentCmd) setupExecCmd(cmd *exec.Cmd) {
 	cmd.Stdin  = cc.Stdin
 	cmd.Stdout = cc.Stdout
 	cmd.Stderr = cc.Stderr
 
-	return cmd, nil
+	if cc.Shell != nil {
+		cmd.Env = cc.Shell.Environ()
+		cmd.Dir = cc.Shell.Dir
+	}
+
+	// descriptor N of the command is ExtraFiles[N-3]
+	for fd, f := range cc.Fds {
+		for len(cmd.ExtraFiles) <= fd - 3 {
+			cmd.ExtraFiles = append(cmd.ExtraFiles, nil)
+		}
+		cmd.ExtraFiles[fd-3] = f
+	}
+}
+
+// start starts cmd. An executable file without a #! line can't be run by the kernel (ENOEXEC),
+// so like other shells it is run as a script by a new instance of this shell.
+// Returns the command that was actually started.
+func (cc *CurrentCmd) start(cmd *exec.Cmd) (*exec.Cmd, error) {
+	err := cmd.Start()
+	if err == nil || !errors.Is(err, syscall.ENOEXEC) {
+		return cmd, err
+	}
+
+	self, errSelf := os.Executable()
+	if errSelf != nil {
+		return nil, err
+	}
+
+	script := exec.Command(self, append([]string{cmd.Path}, cc.Args...)...)
+	cc.setupExecCmd(script)
+
+	return script, script.Start()
 }
 
 func (cc *CurrentCmd) Run() error {
@@ -44,9 +109,36 @@ func (cc *CurrentCmd) Run() error {
 		return err
 	}
 
-	 if err := cmd.Start(); err != nil {
-        return err
-    }
-    
-    return cmd.Wait()
-}
\ No newline at end of file
+	cmd, err = cc.start(cmd)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+// ExitStatus converts the error returned by a finished command into its exit status.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+
+	if errors.Is(err, ErrCommandNotFound) {
+		return 127
+	}
+
+	return 1
+}
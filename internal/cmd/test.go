@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/cond"
+)
+
+// test evaluates the expression of test or [ ... ],
+// the status is 0 if it is true, 1 if false and 2 on errors.
+func (cc *CurrentCmd) test() error {
+	args := cc.Args
+	if cc.Cmd == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			fmt.Fprintf(cc.Stderr, "%s: missing `]'\n", cc.Cmd)
+			return &StatusError{Code: 2}
+		}
+		args = args[:len(args)-1]
+	}
+
+	ok, err := cond.Test(args, cc.Shell)
+	if err != nil {
+		fmt.Fprintf(cc.Stderr, "%s: %v\n", cc.Cmd, err)
+		return &StatusError{Code: 2}
+	}
+	if !ok {
+		return &StatusError{Code: 1}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
 	"github.com/codecrafters-io/shell-starter-go/internal/utils/path"
 )
 
@@ -18,7 +19,9 @@ type cmdCompleter struct {
 	externals   	[]string  // executable files founds in PATHs
 	searchDir    	string	  // not "" when the user includes a path
 	loadedExt		bool	  // flag for load externals just one in the session
+	extPath			string	  // PATH the externals were found in, they are searched again when it changes
 	searchCmd		bool	  // flag to determine where exactly we will look
+	shell			*state.Shell // files are completed in its working directory
 }
 
 type Match struct {
@@ -26,8 +29,9 @@ type Match struct {
 	isDir 	 bool    // if dir = / else " " for single matches
 }
 
-func NewCmdCompleter() *cmdCompleter {
+func NewCmdCompleter(sh *state.Shell) *cmdCompleter {
 	cc := &cmdCompleter{
+		shell: sh,
 		matches: []Match{},
 		tab: 0,
 		builtins: []string{"echo", "exit"},
@@ -37,9 +41,14 @@ func NewCmdCompleter() *cmdCompleter {
 	return cc
 }
 
-// ScanExternals searches for unique executable files from PATH and save in slice cc.externals.
+// ScanExternals searches for unique executable files from PATH of the shell and save in slice cc.externals.
 func (cc *cmdCompleter) ScanExternals() {
-	listDirs := path.GetListPath()
+	pathEnv := cc.pathEnv()
+	cc.externals = []string{}
+	cc.extPath = pathEnv
+	cc.loadedExt = true
+
+	listDirs := path.SplitPath(pathEnv)
 	if listDirs == nil {
 		return
 	}
@@ -72,8 +81,15 @@ func (cc *cmdCompleter) ScanExternals() {
 			}
 		}
 	}
+}
 
-	cc.loadedExt = true
+// pathEnv returns PATH of the shell, which may differ from the one of the process.
+func (cc *cmdCompleter) pathEnv() string {
+	if cc.shell == nil {
+		return os.Getenv("PATH")
+	}
+	pathEnv, _ := cc.shell.Get("PATH")
+	return pathEnv
 }
 
 // GetMatches searches for unique matches with the prefix.
@@ -119,10 +135,7 @@ func (cc *cmdCompleter) LongestCommonPrefix() []rune {
 }
 
 func (cc *cmdCompleter) SearchMatchInCurrentDir() {
-	curDir, err := os.Getwd()
-	if err != nil {
-		return
-	}
+	curDir := cc.shell.Dir
 
 	if cc.searchDir != "" {
 		curDir = filepath.Join(curDir, cc.searchDir)
@@ -27,7 +27,7 @@ func (cc *cmdCompleter) Do(line []rune, pos int) ([][]rune, int) {
 	cc.lenPrefixInRune = len([]rune(prefix))
 	cc.matches = []Match{}
 
-	if cc.searchCmd && !cc.loadedExt {
+	if cc.searchCmd && (!cc.loadedExt || cc.extPath != cc.pathEnv()) {
 		cc.ScanExternals()
 	}
 
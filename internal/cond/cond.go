@@ -0,0 +1,155 @@
+package cond
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Env is the shell the tests run in: its variables for -v and
+// its working directory for relative filenames.
+type Env interface {
+	Get(name string) (string, bool)
+	Path(name string) string
+	Option(name string) bool
+}
+
+// Unary evaluates the test op arg, like -f file or -z string.
+func Unary(op, arg string, env Env) (bool, error) {
+	switch op {
+	case "-z":
+		return arg == "", nil
+	case "-n":
+		return arg != "", nil
+	case "-v":
+		_, ok := env.Get(arg)
+		return ok, nil
+	case "-o":
+		return env.Option(arg), nil
+	case "-t":
+		fd, err := strconv.Atoi(strings.TrimSpace(arg))
+		if err != nil {
+			return false, fmt.Errorf("%s: integer expression expected", arg)
+		}
+		var stat syscall.Stat_t
+		err = syscall.Fstat(fd, &stat)
+		return err == nil && stat.Mode & syscall.S_IFMT == syscall.S_IFCHR, nil
+	}
+
+	name := env.Path(arg)
+	switch op {
+	case "-h", "-L":
+		info, err := os.Lstat(name)
+		return err == nil && info.Mode() & os.ModeSymlink != 0, nil
+	case "-r":
+		return syscall.Access(name, 4) == nil, nil
+	case "-w":
+		return syscall.Access(name, 2) == nil, nil
+	case "-x":
+		return syscall.Access(name, 1) == nil, nil
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return false, nil
+	}
+	mode := info.Mode()
+	stat, _ := info.Sys().(*syscall.Stat_t)
+
+	switch op {
+	case "-a", "-e":
+		return true, nil
+	case "-f":
+		return mode.IsRegular(), nil
+	case "-d":
+		return mode.IsDir(), nil
+	case "-s":
+		return info.Size() > 0, nil
+	case "-b":
+		return mode & os.ModeDevice != 0 && mode & os.ModeCharDevice == 0, nil
+	case "-c":
+		return mode & os.ModeCharDevice != 0, nil
+	case "-p":
+		return mode & os.ModeNamedPipe != 0, nil
+	case "-S":
+		return mode & os.ModeSocket != 0, nil
+	case "-g":
+		return mode & os.ModeSetgid != 0, nil
+	case "-u":
+		return mode & os.ModeSetuid != 0, nil
+	case "-k":
+		return mode & os.ModeSticky != 0, nil
+	case "-O":
+		return stat != nil && int(stat.Uid) == os.Geteuid(), nil
+	case "-G":
+		return stat != nil && int(stat.Gid) == os.Getegid(), nil
+	case "-N":
+		return stat != nil && modifiedSinceRead(stat), nil
+	}
+
+	return false, fmt.Errorf("%s: unary operator expected", op)
+}
+
+// Binary evaluates the test x op y, like x = y or x -lt y.
+func Binary(op, x, y string, env Env) (bool, error) {
+	switch op {
+	case "=", "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case ">":
+		return x > y, nil
+	case "-nt", "-ot":
+		xInfo, xErr := os.Stat(env.Path(x))
+		yInfo, yErr := os.Stat(env.Path(y))
+		if op == "-ot" {
+			xInfo, xErr, yInfo, yErr = yInfo, yErr, xInfo, xErr
+		}
+		if xErr != nil {
+			return false, nil
+		}
+		return yErr != nil || xInfo.ModTime().After(yInfo.ModTime()), nil
+	case "-ef":
+		xInfo, xErr := os.Stat(env.Path(x))
+		yInfo, yErr := os.Stat(env.Path(y))
+		return xErr == nil && yErr == nil && os.SameFile(xInfo, yInfo), nil
+	}
+
+	a, err := integer(x)
+	if err != nil {
+		return false, err
+	}
+	b, err := integer(y)
+	if err != nil {
+		return false, err
+	}
+
+	switch op {
+	case "-eq":
+		return a == b, nil
+	case "-ne":
+		return a != b, nil
+	case "-lt":
+		return a < b, nil
+	case "-le":
+		return a <= b, nil
+	case "-gt":
+		return a > b, nil
+	case "-ge":
+		return a >= b, nil
+	}
+
+	return false, fmt.Errorf("%s: binary operator expected", op)
+}
+
+func integer(s string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: integer expression expected", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,10 @@
+//go:build linux || openbsd
+
+package cond
+
+import "syscall"
+
+// modifiedSinceRead reports whether the file was modified since it was last read (-N).
+func modifiedSinceRead(stat *syscall.Stat_t) bool {
+	return stat.Mtim.Nano() > stat.Atim.Nano()
+}
@@ -0,0 +1,140 @@
+package cond
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// Test evaluates the arguments of the test builtin.
+// Up to four arguments are read by their count as POSIX says,
+// longer expressions are parsed with ! -a -o and parentheses.
+func Test(args []string, env Env) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			return args[1] == "", nil
+		}
+		if parser.IsUnaryTest(args[0]) {
+			return Unary(args[0], args[1], env)
+		}
+		return false, fmt.Errorf("%s: unary operator expected", args[0])
+	case 3:
+		if parser.IsBinaryTest(args[1]) {
+			return Binary(args[1], args[0], args[2], env)
+		}
+		if args[1] == "-a" || args[1] == "-o" {
+			break
+		}
+		if args[0] == "!" {
+			ok, err := Test(args[1:], env)
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return args[1] != "", nil
+		}
+		return false, fmt.Errorf("%s: binary operator expected", args[1])
+	case 4:
+		if args[0] == "!" {
+			ok, err := Test(args[1:], env)
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return Test(args[1:3], env)
+		}
+	}
+
+	t := &tester{args: args, env: env}
+	ok, err := t.or()
+	if err != nil {
+		return false, err
+	}
+	if t.pos < len(t.args) {
+		return false, fmt.Errorf("%s: unexpected argument", t.args[t.pos])
+	}
+	return ok, nil
+}
+
+type tester struct {
+	args []string
+	pos  int
+	env Env
+}
+
+func (t *tester) peek(n int) string {
+	if t.pos + n < len(t.args) {
+		return t.args[t.pos+n]
+	}
+	return ""
+}
+
+func (t *tester) left() int {
+	return len(t.args) - t.pos
+}
+
+func (t *tester) or() (bool, error) {
+	x, err := t.and()
+	for err == nil && t.left() > 0 && t.peek(0) == "-o" {
+		t.pos++
+		var y bool
+		y, err = t.and()
+		x = x || y
+	}
+	return x, err
+}
+
+func (t *tester) and() (bool, error) {
+	x, err := t.not()
+	for err == nil && t.left() > 0 && t.peek(0) == "-a" {
+		t.pos++
+		var y bool
+		y, err = t.not()
+		x = x && y
+	}
+	return x, err
+}
+
+func (t *tester) not() (bool, error) {
+	if t.left() > 1 && t.peek(0) == "!" {
+		t.pos++
+		x, err := t.not()
+		return !x, err
+	}
+	return t.primary()
+}
+
+func (t *tester) primary() (bool, error) {
+	if t.left() == 0 {
+		return false, fmt.Errorf("argument expected")
+	}
+
+	switch {
+	case t.left() >= 3 && parser.IsBinaryTest(t.peek(1)):
+		x, op, y := t.peek(0), t.peek(1), t.peek(2)
+		t.pos += 3
+		return Binary(op, x, y, t.env)
+	case t.peek(0) == "(":
+		t.pos++
+		x, err := t.or()
+		if err != nil {
+			return false, err
+		}
+		if t.peek(0) != ")" || t.left() == 0 {
+			return false, fmt.Errorf("`)' expected")
+		}
+		t.pos++
+		return x, nil
+	case t.left() >= 2 && parser.IsUnaryTest(t.peek(0)):
+		op, arg := t.peek(0), t.peek(1)
+		t.pos += 2
+		return Unary(op, arg, t.env)
+	}
+
+	arg := t.peek(0)
+	t.pos++
+	return arg != "", nil
+}
@@ -0,0 +1,588 @@
+package expand
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+// Expander does the expansions of words right before a command runs:
+// tilde, parameters, arithmetic, command substitution and quote removal.
+type Expander struct {
+	Sh 	  *state.Shell
+	Subst func(cmds string) (string, error)	// runs the commands and returns their output
+	// ProcSubst starts the commands connected to a pipe and returns its /dev/fd path,
+	// output is true for >(cmds) that read from the pipe
+	ProcSubst func(cmds string, output bool) (string, error)
+}
+
+// ParamError is an error of a parameter that is not set, with set -u or ${name?message}.
+// A shell that is not interactive exits on it.
+type ParamError struct {
+	Name string
+	Msg  string
+}
+
+func (e *ParamError) Error() string {
+	return e.Name + ": " + e.Msg
+}
+
+// ArithError is an error of an arithmetic expansion $(( expression )).
+// A shell that is not interactive exits on it, an interactive one drops the rest of the line.
+type ArithError struct {
+	Err error
+}
+
+func (e *ArithError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ArithError) Unwrap() error {
+	return e.Err
+}
+
+// unbound returns the error of set -u for the parameter that is not set, or nil without set -u.
+func (e *Expander) unbound(name string) error {
+	if !e.Sh.Option("nounset") {
+		return nil
+	}
+	return &ParamError{Name: name, Msg: "unbound variable"}
+}
+
+// piece is a part of an expanded word.
+type piece struct {
+	text   string
+	quoted bool				// written in quotes or escaped
+	brk    bool				// starts a new field, as between the parameters of "$@"
+	split  bool				// result of an unquoted expansion, split on IFS
+}
+
+// mode of scanning a word
+type mode int
+
+const (
+	modeWord mode = iota
+	modeAssign				// value of assignment, ~ after = and :
+	modeHereDoc				// quotes are ordinary characters
+)
+
+// Fields expands the words of a command into its arguments.
+// Results of unquoted expansions are split on IFS, then the fields with
+// unquoted pattern characters are replaced with the matching filenames.
+// A word that expands to nothing without any quotes is removed.
+func (e *Expander) Fields(words []string) ([]string, error) {
+	fields := make([]string, 0, len(words))
+
+	for _, word := range words {
+		pieces, err := e.expandWord(word, modeWord)
+		if err != nil {
+			return nil, err
+		}
+
+		fb := &fieldBuilder{ifs: e.ifs()}
+		for _, p := range pieces {
+			switch {
+			case p.brk:
+				fb.end()
+			case p.split:
+				fb.split(p.text)
+			default:
+				fb.write(p.text, p.quoted)
+			}
+		}
+		fb.end()
+
+		for _, f := range fb.fields {
+			if f.glob && !e.Sh.Option("noglob") {
+				if matches := e.glob(f.pat); len(matches) > 0 {
+					fields = append(fields, matches...)
+					continue
+				}
+			}
+			fields = append(fields, f.text)
+		}
+	}
+
+	return fields, nil
+}
+
+// Literal expands the word into one string, as for redirection targets and case words.
+func (e *Expander) Literal(word string) (string, error) {
+	pieces, err := e.expandWord(word, modeWord)
+	if err != nil {
+		return "", err
+	}
+
+	text, _ := join(pieces)
+	return text, nil
+}
+
+// Assignment expands the value of name=value.
+func (e *Expander) Assignment(value string) (string, error) {
+	pieces, err := e.expandWord(value, modeAssign)
+	if err != nil {
+		return "", err
+	}
+
+	text, _ := join(pieces)
+	return text, nil
+}
+
+// Pattern expands the word into a pattern for matching,
+// the quoted parts match literally.
+func (e *Expander) Pattern(word string) (string, error) {
+	pieces, err := e.expandWord(word, modeWord)
+	if err != nil {
+		return "", err
+	}
+
+	buf := strings.Builder{}
+	for _, p := range pieces {
+		if p.quoted {
+			buf.WriteString(pattern.Quote(p.text))
+		} else {
+			buf.WriteString(p.text)
+		}
+	}
+	return buf.String(), nil
+}
+
+// Regexp expands the right side of =~ into a regular expression,
+// the quoted parts match literally.
+func (e *Expander) Regexp(word string) (string, error) {
+	pieces, err := e.expandWord(word, modeWord)
+	if err != nil {
+		return "", err
+	}
+
+	buf := strings.Builder{}
+	for _, p := range pieces {
+		if p.quoted {
+			buf.WriteString(regexp.QuoteMeta(p.text))
+		} else {
+			buf.WriteString(p.text)
+		}
+	}
+	return buf.String(), nil
+}
+
+// HereDoc expands the body of a here-document, in which quotes are ordinary characters.
+func (e *Expander) HereDoc(body string) (string, error) {
+	pieces, err := e.expandWord(body, modeHereDoc)
+	if err != nil {
+		return "", err
+	}
+
+	text, _ := join(pieces)
+	return text, nil
+}
+
+// join returns the text of pieces and whether any of them was quoted.
+func join(pieces []piece) (string, bool) {
+	buf := strings.Builder{}
+	quoted := false
+	for _, p := range pieces {
+		if p.brk {
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(p.text)
+		quoted = quoted || p.quoted
+	}
+	return buf.String(), quoted
+}
+
+type scanner struct {
+	e 		  *Expander
+	src 	  string
+	pos 	  int
+	mode 	  mode
+	pieces 	  []piece
+	emptyList bool			// "$@" expanded to no fields
+}
+
+func (s *scanner) add(text string, quoted bool) {
+	s.pieces = append(s.pieces, piece{text: text, quoted: quoted})
+}
+
+// addExpansion adds the result of an expansion, split into fields if it is not quoted.
+func (s *scanner) addExpansion(text string, quoted bool) {
+	s.pieces = append(s.pieces, piece{text: text, quoted: quoted, split: !quoted})
+}
+
+func (e *Expander) expandWord(word string, m mode) ([]piece, error) {
+	s := &scanner{e: e, src: word, mode: m}
+
+	if m != modeHereDoc {
+		s.tilde()
+	}
+
+	for s.pos < len(s.src) {
+		ch := s.src[s.pos]
+
+		var err error
+		switch {
+		case ch == '\\' && m == modeHereDoc:
+			s.escape("$`\\")
+		case ch == '\\':
+			s.escape("")
+		case ch == '\'' && m != modeHereDoc:
+			end := strings.IndexByte(s.src[s.pos+1:], '\'')
+			if end == -1 {
+				end = len(s.src) - s.pos - 1
+			}
+			// '' is an empty argument
+			s.add(s.src[s.pos+1:s.pos+1+end], true)
+			s.pos += end + 2
+		case ch == '"' && m != modeHereDoc:
+			err = s.doubleQuoted()
+		case ch == '$' || ch == '`':
+			err = s.dollar(m == modeHereDoc)
+		case (ch == '<' || ch == '>') && m == modeWord && strings.HasPrefix(s.src[s.pos+1:], "("):
+			err = s.procSubst()
+		default:
+			s.add(s.src[s.pos:s.pos+1], m == modeHereDoc)
+			s.pos++
+			if m == modeAssign && ch == ':' {
+				s.tilde()
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.pieces, nil
+}
+
+// escape handles a backslash. In quotes it escapes only the characters
+// of escapable and newline, empty escapable means any character.
+func (s *scanner) escape(escapable string) {
+	if s.pos + 1 >= len(s.src) {
+		s.add("\\", true)
+		s.pos++
+		return
+	}
+
+	next := s.src[s.pos+1]
+	switch {
+	case next == '\n':
+		// line continuation
+	case escapable == "" || strings.IndexByte(escapable, next) != -1:
+		s.add(s.src[s.pos+1:s.pos+2], true)
+	default:
+		s.add(s.src[s.pos:s.pos+2], true)
+	}
+	s.pos += 2
+}
+
+func (s *scanner) doubleQuoted() error {
+	s.pos++
+	// "" is an empty argument, but "$@" without parameters is nothing
+	mark := len(s.pieces)
+	s.add("", true)
+	s.emptyList = false
+
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '"':
+			s.pos++
+			if s.emptyList && len(s.pieces) == mark + 1 {
+				s.pieces = s.pieces[:mark]
+			}
+			return nil
+		case '\\':
+			s.escape("$`\"\\")
+		case '$', '`':
+			if err := s.dollar(true); err != nil {
+				return err
+			}
+		default:
+			s.add(s.src[s.pos:s.pos+1], true)
+			s.pos++
+		}
+	}
+	return nil
+}
+
+// tilde expands ~ and ~user at the current position.
+func (s *scanner) tilde() {
+	if s.pos >= len(s.src) || s.src[s.pos] != '~' {
+		return
+	}
+
+	end := s.pos + 1
+	for end < len(s.src) && s.src[end] != '/' && !(s.mode == modeAssign && s.src[end] == ':') {
+		// only unquoted characters are in a login name
+		if strings.IndexByte("\\'\"$`", s.src[end]) != -1 {
+			return
+		}
+		end++
+	}
+
+	login := s.src[s.pos+1:end]
+	var home string
+	if login == "" {
+		home, _ = s.e.Sh.Get("HOME")
+	} else if u, err := user.Lookup(login); err == nil {
+		home = u.HomeDir
+	}
+	if home == "" {
+		return
+	}
+
+	s.add(home, true)
+	s.pos = end
+}
+
+// dollar expands $name, ${...} and the substitutions at the current position.
+func (s *scanner) dollar(quoted bool) error {
+	start := s.pos
+	if strings.HasPrefix(s.src[start:], "$((") {
+		return s.arith(quoted)
+	}
+	if s.src[start] == '`' || strings.HasPrefix(s.src[start:], "$(") {
+		return s.substitute(quoted)
+	}
+
+	s.pos++
+	if s.pos >= len(s.src) {
+		s.add("$", quoted)
+		return nil
+	}
+
+	ch := s.src[s.pos]
+	switch {
+	case ch == '{':
+		end, err := parser.SubstEnd(s.src, start)
+		if err != nil {
+			return fmt.Errorf("%s: bad substitution", s.src[start:])
+		}
+		s.pos = end
+
+		v, err := s.e.paramExpansion(s.src[start+2:end-1])
+		if err != nil {
+			return err
+		}
+		s.addValue(v, quoted)
+	case ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z':
+		end := s.pos
+		for end < len(s.src) && isNameChar(s.src[end]) {
+			end++
+		}
+		value, ok := s.e.Sh.Get(s.src[s.pos:end])
+		if !ok {
+			if err := s.e.unbound(s.src[s.pos:end]); err != nil {
+				return err
+			}
+		}
+		s.addExpansion(value, quoted)
+		s.pos = end
+	case '0' <= ch && ch <= '9':
+		s.pos++
+		n := int(ch - '0')
+		if n > len(s.e.Sh.Params) {
+			if err := s.e.unbound("$" + string(ch)); err != nil {
+				return err
+			}
+		}
+		s.addExpansion(s.e.positional(n), quoted)
+	case ch == '@' || ch == '*':
+		s.pos++
+		s.addValue(value{list: s.e.Sh.Params, join: ch}, quoted)
+	case strings.IndexByte("#?$!-", ch) != -1:
+		s.pos++
+		value, _ := s.e.special(ch)
+		s.addExpansion(value, quoted)
+	default:
+		s.add("$", quoted)
+	}
+
+	return nil
+}
+
+// substitute replaces $(commands) or `commands` with the output of the commands,
+// without the trailing newlines.
+func (s *scanner) substitute(quoted bool) error {
+	start := s.pos
+	end, err := parser.SubstEnd(s.src, start)
+	if err != nil {
+		return fmt.Errorf("%s: bad substitution", s.src[start:])
+	}
+	s.pos = end
+
+	var cmds string
+	if s.src[start] == '`' {
+		cmds = unescapeBackquoted(s.src[start+1:end-1])
+	} else {
+		cmds = s.src[start+2:end-1]
+	}
+
+	if s.e.Subst == nil {
+		return fmt.Errorf("%s: substitution is not supported", s.src[start:end])
+	}
+	out, err := s.e.Subst(cmds)
+	if err != nil {
+		return err
+	}
+
+	s.addExpansion(strings.TrimRight(out, "\n"), quoted)
+	return nil
+}
+
+// procSubst replaces <(commands) or >(commands) with the path of a pipe
+// connected to the commands.
+func (s *scanner) procSubst() error {
+	start := s.pos
+	end, err := parser.SubstEnd(s.src, start)
+	if err != nil {
+		return fmt.Errorf("%s: bad substitution", s.src[start:])
+	}
+	s.pos = end
+
+	if s.e.ProcSubst == nil {
+		return fmt.Errorf("%s: process substitution is not supported", s.src[start:end])
+	}
+	path, err := s.e.ProcSubst(s.src[start+2:end-1], s.src[start] == '>')
+	if err != nil {
+		return err
+	}
+
+	s.add(path, false)
+	return nil
+}
+
+// unescapeBackquoted removes the backslashes before $ ` and \ inside `...`.
+func unescapeBackquoted(src string) string {
+	buf := strings.Builder{}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\\' && i + 1 < len(src) && strings.IndexByte("$`\\", src[i+1]) != -1 {
+			i++
+		}
+		buf.WriteByte(src[i])
+	}
+	return buf.String()
+}
+
+// arith expands $(( expression )) at the current position.
+func (s *scanner) arith(quoted bool) error {
+	start := s.pos
+	end, err := parser.SubstEnd(s.src, start)
+	if err != nil {
+		return fmt.Errorf("%s: bad substitution", s.src[start:])
+	}
+	s.pos = end
+
+	// parameters inside the expression are expanded first
+	expr, err := s.e.Literal(s.src[start+3:end-2])
+	if err != nil {
+		return err
+	}
+	n, err := arith.Eval(expr, s.e.Sh)
+	if err != nil {
+		return &ArithError{Err: err}
+	}
+
+	s.addExpansion(strconv.FormatInt(n, 10), quoted)
+	return nil
+}
+
+func isNameChar(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+// addValue adds the value of a parameter. The elements of "$@" and "${a[@]}"
+// are separate fields, of "$*" one field joined by the first character of IFS.
+func (s *scanner) addValue(v value, quoted bool) {
+	if v.join == 0 {
+		s.addExpansion(v.str, quoted)
+		return
+	}
+
+	if v.join == '*' && quoted {
+		s.addExpansion(s.e.joinStar(v.list), true)
+		return
+	}
+
+	if len(v.list) == 0 && quoted {
+		s.emptyList = true
+	}
+	for i, elem := range v.list {
+		if i > 0 {
+			s.pieces = append(s.pieces, piece{brk: true})
+		}
+		s.addExpansion(elem, quoted)
+	}
+}
+
+// joinStar joins the elements the way "$*" does.
+func (e *Expander) joinStar(list []string) string {
+	sep := " "
+	if ifs, ok := e.Sh.Get("IFS"); ok {
+		sep = ""
+		if ifs != "" {
+			sep = ifs[:1]
+		}
+	}
+	return strings.Join(list, sep)
+}
+
+// special returns the value of the special parameters $# $$ $! $- and $?.
+func (e *Expander) special(ch byte) (string, bool) {
+	switch ch {
+	case '#':
+		return strconv.Itoa(len(e.Sh.Params)), true
+	case '?':
+		return strconv.Itoa(e.Sh.Status), true
+	case '$':
+		// subshells run in the same process
+		return strconv.Itoa(os.Getpid()), true
+	case '!':
+		if e.Sh.LastJob == nil {
+			return "", false
+		}
+		return strconv.Itoa(e.Sh.LastJob.Pid), true
+	case '-':
+		return e.Sh.Flags(), true
+	}
+	return "", false
+}
+
+// ifs returns the field separators, space, tab and newline if IFS is unset.
+func (e *Expander) ifs() string {
+	if ifs, ok := e.Sh.Get("IFS"); ok {
+		return ifs
+	}
+	return defaultIFS
+}
+
+// positional returns $n, $0 is the name of the shell or script.
+func (e *Expander) positional(n int) string {
+	if n == 0 {
+		return e.Sh.Name
+	}
+	if n > len(e.Sh.Params) {
+		return ""
+	}
+	return e.Sh.Params[n-1]
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package expand
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+// glob returns the sorted filenames that match the pattern. Relative patterns
+// are matched in the working directory of the shell and give relative names.
+// Names starting with a dot match only a pattern that starts with a dot.
+func (e *Expander) glob(pat string) []string {
+	matches := []string{""}
+	if strings.HasPrefix(pat, "/") {
+		matches[0] = "/"
+		pat = strings.TrimLeft(pat, "/")
+	}
+
+	parts := strings.Split(pat, "/")
+	for i, part := range parts {
+		next := []string{}
+
+		for _, m := range matches {
+			if !pattern.HasMeta(part) {
+				next = append(next, m + pattern.Unquote(part))
+				continue
+			}
+
+			dir := e.Sh.Dir
+			if m != "" {
+				dir = e.Sh.Path(m)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if name[0] == '.' && !strings.HasPrefix(part, ".") && !strings.HasPrefix(part, `\.`) {
+					continue
+				}
+				if pattern.Match(part, name) {
+					next = append(next, m + name)
+				}
+			}
+		}
+
+		// all but the last part are directories
+		if i < len(parts) - 1 {
+			dirs := next[:0]
+			for _, name := range next {
+				if info, err := os.Stat(e.Sh.Path(name)); err == nil && info.IsDir() {
+					dirs = append(dirs, name + "/")
+				}
+			}
+			next = dirs
+		}
+		matches = next
+	}
+
+	result := make([]string, 0, len(matches))
+	for _, name := range matches {
+		if _, err := os.Lstat(e.Sh.Path(name)); err == nil {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
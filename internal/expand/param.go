@@ -0,0 +1,612 @@
+package expand
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+// value is the value of a parameter: a string, or the elements of $@, $* and arrays.
+type value struct {
+	str  string
+	set  bool
+	list []string
+	join byte					// '@' or '*' if the value is a list
+}
+
+// null reports whether the value is unset or empty.
+func (v value) null() bool {
+	if v.join != 0 {
+		return len(v.list) == 0
+	}
+	return !v.set || v.str == ""
+}
+
+// each applies f to the string or to every element of the list.
+func (v value) each(f func(string) string) value {
+	if v.join == 0 {
+		if v.set {
+			v.str = f(v.str)
+		}
+		return v
+	}
+
+	list := make([]string, len(v.list))
+	for i, elem := range v.list {
+		list[i] = f(elem)
+	}
+	v.list = list
+	return v
+}
+
+// paramExpansion expands the contents of ${...}.
+func (e *Expander) paramExpansion(expr string) (value, error) {
+	switch {
+	case len(expr) > 1 && expr[0] == '#':
+		// ${#name} is the length, but ${#-word} is an operator on $#
+		if name, rest := paramName(expr[1:]); name != "" && rest == "" {
+			v, err := e.lookup(name)
+			if err != nil {
+				return value{}, err
+			}
+			if !v.set && v.join == 0 {
+				if err := e.unbound(paramLabel(name)); err != nil {
+					return value{}, err
+				}
+			}
+			if v.join != 0 {
+				return value{str: strconv.Itoa(len(v.list)), set: true}, nil
+			}
+			return value{str: strconv.Itoa(utf8.RuneCountInString(v.str)), set: true}, nil
+		}
+	case len(expr) > 1 && expr[0] == '!':
+		return e.indirect(expr)
+	}
+
+	name, rest := paramName(expr)
+	if name == "" {
+		return value{}, fmt.Errorf("${%s}: bad substitution", expr)
+	}
+	v, err := e.lookup(name)
+	if err != nil {
+		return value{}, err
+	}
+	if !v.set && v.join == 0 && !isDefaultOp(rest) {
+		if err := e.unbound(paramLabel(name)); err != nil {
+			return value{}, err
+		}
+	}
+	if rest == "" {
+		return v, nil
+	}
+
+	return e.operator(expr, name, v, rest)
+}
+
+// isDefaultOp reports whether the operator is one of - = ? + or their forms with a colon,
+// which handle unset parameters themselves.
+func isDefaultOp(op string) bool {
+	op = strings.TrimPrefix(op, ":")
+	return op != "" && strings.IndexByte("-=?+", op[0]) != -1
+}
+
+// paramLabel returns how errors name the parameter, $1 for positional parameters.
+func paramLabel(name string) string {
+	if '0' <= name[0] && name[0] <= '9' {
+		return "$" + name
+	}
+	return name
+}
+
+// paramName splits the name of the parameter from the operator after it.
+// The name is a variable with an optional [subscript], digits or a special parameter.
+func paramName(expr string) (name, rest string) {
+	if expr == "" {
+		return "", ""
+	}
+
+	ch := expr[0]
+	switch {
+	case '0' <= ch && ch <= '9':
+		end := 1
+		for end < len(expr) && '0' <= expr[end] && expr[end] <= '9' {
+			end++
+		}
+		return expr[:end], expr[end:]
+	case strings.IndexByte("@*#?$!-", ch) != -1:
+		return expr[:1], expr[1:]
+	case !isNameChar(ch):
+		return "", expr
+	}
+
+	end := 1
+	for end < len(expr) && isNameChar(expr[end]) {
+		end++
+	}
+	if end < len(expr) && expr[end] == '[' {
+		if close := strings.IndexByte(expr[end:], ']'); close != -1 {
+			end += close + 1
+		}
+	}
+	return expr[:end], expr[end:]
+}
+
+// lookup returns the value of the parameter named as paramName returns it.
+func (e *Expander) lookup(name string) (value, error) {
+	ch := name[0]
+	switch {
+	case ch == '@' || ch == '*':
+		return value{list: e.Sh.Params, join: ch, set: len(e.Sh.Params) > 0}, nil
+	case '0' <= ch && ch <= '9':
+		n, err := strconv.Atoi(name)
+		if err != nil || n > len(e.Sh.Params) {
+			return value{}, nil
+		}
+		return value{str: e.positional(n), set: true}, nil
+	case !isNameChar(ch):
+		str, ok := e.special(ch)
+		return value{str: str, set: ok}, nil
+	}
+
+	if base, sub, ok := state.SplitSubscript(name); ok {
+		if sub == "@" || sub == "*" {
+			elems := e.Sh.Elems(base)
+			return value{list: elems, join: sub[0], set: len(elems) > 0}, nil
+		}
+		sub, err := e.Literal(sub)
+		if err != nil {
+			return value{}, err
+		}
+		if !e.Sh.IsAssoc(base) {
+			i, err := arith.Eval(sub, e.Sh)
+			if err != nil {
+				return value{}, err
+			}
+			sub = strconv.FormatInt(i, 10)
+		}
+		name = base + "[" + sub + "]"
+	}
+
+	str, ok := e.Sh.Get(name)
+	return value{str: str, set: ok}, nil
+}
+
+// indirect expands ${!prefix*}, ${!prefix@} and ${!name}, whose value names the parameter.
+func (e *Expander) indirect(expr string) (value, error) {
+	rest := expr[1:]
+	if base, sub, ok := state.SplitSubscript(rest); ok && parser.IsName(base) && (sub == "@" || sub == "*") {
+		keys := e.Sh.Keys(base)
+		return value{list: keys, join: sub[0], set: len(keys) > 0}, nil
+	}
+	if prefix := rest[:len(rest)-1]; parser.IsName(prefix) && (strings.HasSuffix(rest, "*") || strings.HasSuffix(rest, "@")) {
+		names := []string{}
+		for name := range e.Sh.Vars {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return value{list: names, join: rest[len(rest)-1], set: len(names) > 0}, nil
+	}
+
+	name, op := paramName(rest)
+	if name == "" {
+		return value{}, fmt.Errorf("${%s}: bad substitution", expr)
+	}
+	ref, err := e.lookup(name)
+	if err != nil {
+		return value{}, err
+	}
+	if !ref.set {
+		return value{}, nil
+	}
+
+	target, targetRest := paramName(ref.str)
+	if target == "" || targetRest != "" {
+		return value{}, fmt.Errorf("%s: invalid indirect expansion", ref.str)
+	}
+	v, err := e.lookup(target)
+	if err != nil || op == "" {
+		return v, err
+	}
+	return e.operator(expr, target, v, op)
+}
+
+// operator applies the operator after the name of the parameter.
+func (e *Expander) operator(expr, name string, v value, op string) (value, error) {
+	switch {
+	case strings.IndexByte("-=?+", op[0]) != -1, len(op) > 1 && op[0] == ':' && strings.IndexByte("-=?+", op[1]) != -1:
+		return e.defaults(name, v, op)
+	case op[0] == ':':
+		return e.substring(name, v, op[1:])
+	case op[0] == '#' || op[0] == '%':
+		return e.remove(v, op)
+	case op[0] == '/':
+		return e.replace(v, op[1:])
+	case op[0] == '^' || op[0] == ',':
+		return e.changeCase(v, op)
+	case op[0] == '@' && len(op) == 2:
+		return transform(v, op[1])
+	}
+
+	return value{}, fmt.Errorf("${%s}: bad substitution", expr)
+}
+
+// defaults handles - = ? + and the forms with a colon, which also treat an empty value as unset.
+func (e *Expander) defaults(name string, v value, op string) (value, error) {
+	unset := !v.set
+	if op[0] == ':' {
+		unset = v.null()
+		op = op[1:]
+	}
+	word := op[1:]
+
+	switch op[0] {
+	case '-':
+		if !unset {
+			return v, nil
+		}
+		str, err := e.Literal(word)
+		return value{str: str, set: true}, err
+	case '=':
+		if !unset {
+			return v, nil
+		}
+		if !parser.IsName(name) {
+			return value{}, fmt.Errorf("$%s: cannot assign in this way", name)
+		}
+		str, err := e.Literal(word)
+		if err != nil {
+			return value{}, err
+		}
+		return value{str: str, set: true}, e.Sh.Set(name, str)
+	case '?':
+		if !unset {
+			return v, nil
+		}
+		msg, err := e.Literal(word)
+		if err != nil {
+			return value{}, err
+		}
+		if msg == "" {
+			msg = "parameter null or not set"
+		}
+		return value{}, &ParamError{Name: paramLabel(name), Msg: msg}
+	}
+
+	// +
+	if unset {
+		return value{}, nil
+	}
+	str, err := e.Literal(word)
+	return value{str: str, set: true}, err
+}
+
+// substring handles :offset and :offset:length, negative numbers count from the end.
+// Offsets of $@ start from $0.
+func (e *Expander) substring(name string, v value, op string) (value, error) {
+	offExpr, lenExpr, hasLen := strings.Cut(op, ":")
+
+	off, err := e.arith(offExpr)
+	if err != nil {
+		return value{}, err
+	}
+	length := int64(0)
+	if hasLen {
+		if length, err = e.arith(lenExpr); err != nil {
+			return value{}, err
+		}
+	}
+
+	if v.join != 0 {
+		list := v.list
+		if name == "@" || name == "*" {
+			list = append([]string{e.Sh.Name}, list...)
+		}
+		start, end, err := bounds(len(list), off, length, hasLen, true)
+		if err != nil {
+			return value{}, err
+		}
+		v.list = list[start:end]
+		return v, nil
+	}
+
+	if !v.set {
+		return v, nil
+	}
+	runes := []rune(v.str)
+	start, end, err := bounds(len(runes), off, length, hasLen, false)
+	if err != nil {
+		return value{}, err
+	}
+	v.str = string(runes[start:end])
+	return v, nil
+}
+
+// bounds returns the slice [start:end] for the offset and the length in n elements.
+// A negative length of a list is an error, of a string it counts from the end.
+func bounds(n int, off, length int64, hasLen, list bool) (int, int, error) {
+	if off < 0 {
+		off += int64(n)
+	}
+	if off < 0 || off > int64(n) {
+		return 0, 0, nil
+	}
+
+	end := int64(n)
+	if hasLen {
+		switch {
+		case length < 0 && list:
+			return 0, 0, fmt.Errorf("%d: substring expression < 0", length)
+		case length < 0:
+			end = int64(n) + length
+			if end < off {
+				return 0, 0, fmt.Errorf("%d: substring expression < 0", length)
+			}
+		case off + length < end:
+			end = off + length
+		}
+	}
+
+	return int(off), int(end), nil
+}
+
+func (e *Expander) arith(expr string) (int64, error) {
+	expr, err := e.Literal(expr)
+	if err != nil {
+		return 0, err
+	}
+	return arith.Eval(expr, e.Sh)
+}
+
+// remove handles #pattern and %pattern, the doubled forms remove the longest match.
+func (e *Expander) remove(v value, op string) (value, error) {
+	kind := op[0]
+	longest := len(op) > 1 && op[1] == kind
+	word := op[1:]
+	if longest {
+		word = op[2:]
+	}
+
+	pat, err := e.Pattern(word)
+	if err != nil {
+		return value{}, err
+	}
+
+	return v.each(func(s string) string {
+		idx := runeBounds(s)
+		// prefixes get longer and suffixes shorter with i
+		if (kind == '#') == longest {
+			for i := len(idx) - 1; i >= 0; i-- {
+				if cut, ok := removeAt(s, idx[i], pat, kind); ok {
+					return cut
+				}
+			}
+		} else {
+			for i := 0; i < len(idx); i++ {
+				if cut, ok := removeAt(s, idx[i], pat, kind); ok {
+					return cut
+				}
+			}
+		}
+		return s
+	}), nil
+}
+
+// removeAt removes s[:i] for # or s[i:] for % if it matches the pattern.
+func removeAt(s string, i int, pat string, kind byte) (string, bool) {
+	if kind == '#' {
+		return s[i:], pattern.Match(pat, s[:i])
+	}
+	return s[:i], pattern.Match(pat, s[i:])
+}
+
+// runeBounds returns the offsets of the characters of s and len(s).
+func runeBounds(s string) []int {
+	idx := make([]int, 0, len(s) + 1)
+	for i := range s {
+		idx = append(idx, i)
+	}
+	return append(idx, len(s))
+}
+
+// replace handles /pattern/string, //pattern/string for all matches,
+// /#pattern/string at the start and /%pattern/string at the end.
+// The longest match is replaced.
+func (e *Expander) replace(v value, op string) (value, error) {
+	mode := byte(0)
+	if op != "" && strings.IndexByte("/#%", op[0]) != -1 {
+		mode = op[0]
+		op = op[1:]
+	}
+
+	patWord, repWord, _ := cutUnquoted(op, '/')
+	pat, err := e.Pattern(patWord)
+	if err != nil {
+		return value{}, err
+	}
+	rep, err := e.Literal(repWord)
+	if err != nil {
+		return value{}, err
+	}
+
+	return v.each(func(s string) string {
+		return replaceMatches(s, pat, rep, mode)
+	}), nil
+}
+
+func replaceMatches(s, pat, rep string, mode byte) string {
+	if !pattern.HasMeta(pat) {
+		return replaceLiteral(s, pattern.Unquote(pat), rep, mode)
+	}
+
+	// the leftmost longest match, the regular expression finds it in one pass
+	expr := "(?s:" + pattern.Regexp(pat) + ")"
+	switch mode {
+	case '#':
+		expr = "^" + expr
+	case '%':
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return s
+	}
+	re.Longest()
+
+	if mode == '#' || mode == '%' {
+		loc := re.FindStringIndex(s)
+		if loc == nil {
+			return s
+		}
+		return s[:loc[0]] + rep + s[loc[1]:]
+	}
+
+	buf := strings.Builder{}
+	pos := 0
+	for pos < len(s) {
+		loc := re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos + loc[0], pos + loc[1]
+		if start == end {
+			// an empty match is not replaced, the search goes on after the character
+			_, size := utf8.DecodeRuneInString(s[start:])
+			buf.WriteString(s[pos:start+size])
+			pos = start + size
+			continue
+		}
+
+		buf.WriteString(s[pos:start])
+		buf.WriteString(rep)
+		pos = end
+		if mode != '/' {
+			break
+		}
+	}
+	buf.WriteString(s[pos:])
+
+	return buf.String()
+}
+
+// replaceLiteral is replaceMatches for a pattern without special characters.
+func replaceLiteral(s, lit, rep string, mode byte) string {
+	switch mode {
+	case '#':
+		if strings.HasPrefix(s, lit) {
+			return rep + s[len(lit):]
+		}
+		return s
+	case '%':
+		if strings.HasSuffix(s, lit) {
+			return s[:len(s)-len(lit)] + rep
+		}
+		return s
+	}
+
+	if lit == "" {
+		return s
+	}
+	if mode == '/' {
+		return strings.ReplaceAll(s, lit, rep)
+	}
+	return strings.Replace(s, lit, rep, 1)
+}
+
+// cutUnquoted cuts s around the first sep that is not quoted or escaped.
+func cutUnquoted(s string, sep byte) (before, after string, found bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '\'':
+			if end := strings.IndexByte(s[i+1:], '\''); end != -1 {
+				i += end + 1
+			}
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		case '$', '`':
+			if end, err := parser.SubstEnd(s, i); err == nil && end > i + 1 {
+				i = end - 1
+			}
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// changeCase handles ^ and , for the first character and ^^ and ,, for all,
+// only the characters that match the optional pattern change.
+func (e *Expander) changeCase(v value, op string) (value, error) {
+	kind := op[0]
+	all := len(op) > 1 && op[1] == kind
+	word := op[1:]
+	if all {
+		word = op[2:]
+	}
+
+	pat := "?"
+	if word != "" {
+		var err error
+		if pat, err = e.Pattern(word); err != nil {
+			return value{}, err
+		}
+	}
+
+	change := unicode.ToUpper
+	if kind == ',' {
+		change = unicode.ToLower
+	}
+
+	return v.each(func(s string) string {
+		runes := []rune(s)
+		for i, r := range runes {
+			if pattern.Match(pat, string(r)) {
+				runes[i] = change(r)
+			}
+			if !all {
+				break
+			}
+		}
+		return string(runes)
+	}), nil
+}
+
+// transform handles @Q quoting for reuse as input, @U @L @u case changes.
+func transform(v value, op byte) (value, error) {
+	switch op {
+	case 'Q':
+		return v.each(func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}), nil
+	case 'U':
+		return v.each(strings.ToUpper), nil
+	case 'L':
+		return v.each(strings.ToLower), nil
+	case 'u':
+		return v.each(func(s string) string {
+			r, size := utf8.DecodeRuneInString(s)
+			if size == 0 {
+				return s
+			}
+			return string(unicode.ToUpper(r)) + s[size:]
+		}), nil
+	}
+
+	return value{}, fmt.Errorf("@%c: bad substitution", op)
+}
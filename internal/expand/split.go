@@ -0,0 +1,162 @@
+package expand
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+const defaultIFS = " \t\n"
+
+// field is a field of a word being built.
+type field struct {
+	text strings.Builder
+	pat  strings.Builder	// the text as a pattern, with the quoted parts escaped
+	has  bool				// the field exists even if it is empty, as ""
+	glob bool				// has unquoted pattern characters
+}
+
+// fieldBuilder splits the pieces of a word into fields on the characters of ifs.
+// Whitespace separators are merged and ignored at the ends, every other
+// separator ends a field, so "a::b" with IFS=: is a, "" and b.
+type fieldBuilder struct {
+	ifs 	string
+	cur 	*field
+	fields 	[]*builtField
+	afterWS bool				// the last field was ended by whitespace, which merges with the next separator
+}
+
+// builtField is a finished field.
+type builtField struct {
+	text string
+	pat  string
+	glob bool
+}
+
+func (fb *fieldBuilder) field() *field {
+	if fb.cur == nil {
+		fb.cur = &field{}
+	}
+	return fb.cur
+}
+
+// write adds text that is not split.
+func (fb *fieldBuilder) write(text string, quoted bool) {
+	f := fb.field()
+	f.text.WriteString(text)
+	if quoted {
+		f.pat.WriteString(pattern.Quote(text))
+	} else {
+		f.pat.WriteString(text)
+		f.glob = f.glob || pattern.HasMeta(text)
+	}
+	f.has = f.has || quoted || text != ""
+	fb.afterWS = false
+}
+
+// split adds the result of an unquoted expansion, splitting it on IFS.
+func (fb *fieldBuilder) split(text string) {
+	start := 0
+	for i := 0; i < len(text); i++ {
+		ch := text[i]
+		if strings.IndexByte(fb.ifs, ch) == -1 {
+			continue
+		}
+
+		if i > start {
+			fb.write(text[start:i], false)
+		}
+		start = i + 1
+
+		if isSpace(ch) {
+			if fb.cur != nil && fb.cur.has {
+				fb.end()
+				fb.afterWS = true
+			}
+			continue
+		}
+
+		// a separator that is not whitespace ends even an empty field
+		if !fb.afterWS || fb.cur != nil && fb.cur.has {
+			fb.field().has = true
+			fb.end()
+		}
+		fb.afterWS = false
+	}
+
+	if start < len(text) {
+		fb.write(text[start:], false)
+	}
+}
+
+// end finishes the current field.
+func (fb *fieldBuilder) end() {
+	f := fb.cur
+	fb.cur = nil
+	if f == nil || !f.has {
+		return
+	}
+	fb.fields = append(fb.fields, &builtField{
+		text: f.text.String(),
+		pat: f.pat.String(),
+		glob: f.glob,
+	})
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n'
+}
+
+// Split splits s into fields on the characters of ifs, the way the results of
+// unquoted expansions are split, for read. The bytes marked in escaped, if it is not nil,
+// are not separators. With n > 0 there are at most n fields, the last one is the rest of s;
+// n 0 splits the whole string.
+func Split(s string, escaped []bool, ifs string, n int) []string {
+	isSep := func(i int) bool {
+		return (escaped == nil || !escaped[i]) && strings.IndexByte(ifs, s[i]) != -1
+	}
+
+	fb := &fieldBuilder{ifs: ifs}
+	for i := 0; i < len(s); i++ {
+		// the rest starts after the separator that ended the field before it
+		if n > 0 && len(fb.fields) == n - 1 && fb.cur == nil && !(isSep(i) && (isSpace(s[i]) || fb.afterWS)) {
+			var rest []bool
+			if escaped != nil {
+				rest = escaped[i:]
+			}
+			fb.write(restField(s[i:], rest, ifs), true)
+			break
+		}
+
+		if isSep(i) {
+			fb.split(s[i:i+1])
+		} else {
+			fb.write(s[i:i+1], true)
+		}
+	}
+	fb.end()
+
+	fields := make([]string, len(fb.fields))
+	for i, f := range fb.fields {
+		fields[i] = f.text
+	}
+	return fields
+}
+
+// restField returns the last field of Split, the rest of the string. If only separators
+// follow its first field, it is that field, otherwise the whole rest without the whitespace
+// separators at its end.
+func restField(rest string, escaped []bool, ifs string) string {
+	if fields := Split(rest, escaped, ifs, 0); len(fields) <= 1 {
+		if len(fields) == 0 {
+			return ""
+		}
+		return fields[0]
+	}
+
+	end := len(rest)
+	for end > 0 && (escaped == nil || !escaped[end-1]) && isSpace(rest[end-1]) && strings.IndexByte(ifs, rest[end-1]) != -1 {
+		end--
+	}
+	return rest[:end]
+}
@@ -0,0 +1,122 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Entry is a command run by the shell, as the history database keeps it.
+type Entry struct {
+	Command 	string			`json:"command"`
+	Cwd 		string			`json:"cwd"`		// working directory the command was run in
+	Status 		int				`json:"status"`
+	Start 		time.Time		`json:"start"`
+	Duration 	time.Duration	`json:"duration"`
+	Host 		string			`json:"host"`
+	Session 	string			`json:"session"`	// shell that ran it
+}
+
+// Query selects the entries of the history database, the zero value selects all.
+type Query struct {
+	Cwd 	string			// the directory or one under it
+	Failed 	bool			// nonzero exit status
+	Since 	time.Time
+	Grep 	*regexp.Regexp	// matched against the command
+	Session string
+}
+
+// RecordTo makes the commands run by this shell be recorded in the history database
+// kept next to the history file, a JSON object per line.
+func (h *History) RecordTo(histfile string) {
+	h.DB = histfile + ".jsonl"
+	h.Session = newSession()
+}
+
+// newSession returns a random id for the entries of one shell.
+func newSession() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Record appends the command that was started at the time and ended with the status
+// to the history database, if there is one.
+func (h *History) Record(command, cwd string, status int, start time.Time) error {
+	if h.DB == "" {
+		return nil
+	}
+
+	e := Entry{
+		Command: command,
+		Cwd: cwd,
+		Status: status,
+		Start: start,
+		Duration: time.Since(start),
+		Session: h.Session,
+	}
+	e.Host, _ = os.Hostname()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, unlock, err := openLocked(h.DB, os.O_APPEND | os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = appendRecords(f, string(data) + "\n")
+	return err
+}
+
+// ReadEntries returns the entries of the history database that match the query, oldest first.
+// Lines that are not entries, like one cut short by a crash, are skipped.
+func ReadEntries(filename string, q Query) ([]Entry, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, line := range fileLines(string(data)) {
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			continue
+		}
+		if q.Match(&e) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+// Match reports whether the query selects the entry.
+func (q *Query) Match(e *Entry) bool {
+	if q.Cwd != "" {
+		dir := filepath.Clean(q.Cwd)
+		if e.Cwd != dir && !strings.HasPrefix(e.Cwd, strings.TrimSuffix(dir, "/") + "/") {
+			return false
+		}
+	}
+	if q.Failed && e.Status == 0 {
+		return false
+	}
+	if !q.Since.IsZero() && e.Start.Before(q.Since) {
+		return false
+	}
+	if q.Grep != nil && !q.Grep.MatchString(e.Command) {
+		return false
+	}
+	if q.Session != "" && e.Session != q.Session {
+		return false
+	}
+	return true
+}
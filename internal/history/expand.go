@@ -0,0 +1,423 @@
+package history
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Substitution is the last :s/old/new/ of history expansion, which :& and an empty old repeat.
+type Substitution struct {
+	Old string
+	New string
+}
+
+// characters after ! that don't start an expansion
+const noExpandChars = " \t\n=("
+
+// characters that end the string of !string
+const eventEndChars = " \t\n:;&|<>()'\"`"
+
+// Expand does the csh-style history expansion of the line before it is parsed:
+// event designators !! !n !-n !string !?string? !#, word designators :0 :n :^ :$ :x-y :* and the
+// modifiers :h :t :r :e :p :q :s/old/new/ :gs/old/new/ :&. ^old^new^ at the start of the line is
+// !!:s^old^new^. Nothing is expanded in single quotes or after a backslash.
+// Returns print true if the line has to be printed and not run (:p).
+func (h *History) Expand(line string) (expanded string, print bool, err error) {
+	if strings.HasPrefix(line, "^") {
+		line = "!!:s" + line
+	}
+	if !strings.Contains(line, "!") {
+		return line, false, nil
+	}
+
+	buf := strings.Builder{}
+	inSingle, inDouble := false, false
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\' && !inSingle && i + 1 < len(line):
+			buf.WriteString(line[i:i+2])
+			i++
+			continue
+		case ch == '\'' && !inDouble:
+			inSingle = !inSingle
+		case ch == '"' && !inSingle:
+			inDouble = !inDouble
+		case ch == '!' && !inSingle && h.startsExpansion(line, i, inDouble):
+			text, end, p, err := h.expandDesignator(line, i, buf.String())
+			if err != nil {
+				return "", false, err
+			}
+			buf.WriteString(text)
+			print = print || p
+			i = end - 1
+			continue
+		}
+		buf.WriteByte(ch)
+	}
+
+	return buf.String(), print, nil
+}
+
+// startsExpansion reports whether the ! at line[i] starts a history expansion.
+func (h *History) startsExpansion(line string, i int, inDouble bool) bool {
+	switch {
+	case i + 1 == len(line):
+		return false
+	case strings.IndexByte(noExpandChars, line[i+1]) != -1:
+		return false
+	case inDouble && line[i+1] == '"':
+		return false
+	// $! and ${!name} are parameters
+	case i > 0 && line[i-1] == '$', i > 1 && line[i-1] == '{' && line[i-2] == '$':
+		return false
+	}
+	return true
+}
+
+// expandDesignator expands the ! at line[start] with its word designators and modifiers.
+// current is the expanded line before it, for !#.
+// Returns the text, the index after the expansion and print for :p.
+func (h *History) expandDesignator(line string, start int, current string) (string, int, bool, error) {
+	i := start + 1
+	event := ""
+	search := ""				// the string of !?string?, for the word designator %
+
+	switch ch := line[i]; {
+	case ch == '!':
+		i++
+		event, _ = h.relative(1)
+	case ch == '#':
+		i++
+		event = current
+	case ch == '?':
+		end := i + 1
+		for end < len(line) && line[end] != '?' && line[end] != '\n' {
+			end++
+		}
+		search = line[i+1:end]
+		i = end
+		if i < len(line) && line[i] == '?' {
+			i++
+		}
+		event, _ = h.find(func(l string) bool { return strings.Contains(l, search) })
+	case '0' <= ch && ch <= '9', ch == '-' && i + 1 < len(line) && '0' <= line[i+1] && line[i+1] <= '9':
+		end := i + 1
+		for end < len(line) && '0' <= line[end] && line[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(line[i:end])
+		i = end
+		if n < 0 {
+			event, _ = h.relative(-n)
+		} else {
+			event, _ = h.absolute(n)
+		}
+	case ch == ':' || strings.IndexByte("^$*%", ch) != -1:
+		// only words of the previous command
+		event, _ = h.relative(1)
+	default:
+		end := i
+		for end < len(line) && strings.IndexByte(eventEndChars, line[end]) == -1 {
+			end++
+		}
+		prefix := line[i:end]
+		i = end
+		event, _ = h.find(func(l string) bool { return strings.HasPrefix(l, prefix) })
+	}
+
+	if event == "" && line[start+1] != '#' {
+		return "", 0, false, fmt.Errorf("%s: event not found", line[start:i])
+	}
+
+	text, i, err := selectWords(event, line, i, search)
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	print := false
+	for i + 1 < len(line) && line[i] == ':' {
+		var done bool
+		text, i, done, err = h.modify(text, line, i + 1, search)
+		if err != nil {
+			return "", 0, false, err
+		}
+		if !done {
+			break
+		}
+		if line[i-1] == 'p' {
+			print = true
+		}
+	}
+
+	return text, i, print, nil
+}
+
+// selectWords applies the word designator at line[i] to the event, without one it is the whole line.
+// Returns the words and the index after the designator.
+func selectWords(event, line string, i int, search string) (string, int, error) {
+	start := i
+	designators := "^$*-%"
+	if i < len(line) && line[i] == ':' {
+		// the colon may be left out before the designators that don't start with a digit
+		designators += "0123456789"
+		i++
+	}
+	if i >= len(line) || strings.IndexByte(designators, line[i]) == -1 {
+		return event, start, nil
+	}
+
+	words := splitWords(event)
+	last := len(words) - 1
+
+	word := func() (int, bool) {
+		switch {
+		case i >= len(line):
+			return 0, false
+		case line[i] == '^':
+			i++
+			return 1, true
+		case line[i] == '$':
+			i++
+			return last, true
+		case line[i] == '%':
+			i++
+			for n, w := range words {
+				if search != "" && strings.Contains(w, search) {
+					return n, true
+				}
+			}
+			return -1, true
+		}
+		end := i
+		for end < len(line) && '0' <= line[end] && line[end] <= '9' {
+			end++
+		}
+		if end == i {
+			return 0, false
+		}
+		n, _ := strconv.Atoi(line[i:end])
+		i = end
+		return n, true
+	}
+
+	from, to := 0, 0
+	switch {
+	case line[i] == '*':
+		i++
+		if last < 1 {
+			return "", i, nil
+		}
+		from, to = 1, last
+	case line[i] == '-':
+		i++
+		n, ok := word()
+		if !ok {
+			n = last - 1
+		}
+		from, to = 0, n
+	default:
+		n, _ := word()
+		from, to = n, n
+		switch {
+		case i < len(line) && line[i] == '*':
+			i++
+			to = last
+		case i < len(line) && line[i] == '-':
+			i++
+			if n, ok := word(); ok {
+				to = n
+			} else {
+				to = last - 1
+			}
+		}
+	}
+
+	if from < 0 || to > last || from > to {
+		return "", 0, fmt.Errorf("%s: bad word specifier", line[start:i])
+	}
+	return strings.Join(words[from:to+1], " "), i, nil
+}
+
+// modify applies the modifier at line[i], after its colon.
+// Returns done false if there is no modifier there, then the colon is text of the line.
+func (h *History) modify(text, line string, i int, search string) (string, int, bool, error) {
+	global := false
+	if line[i] == 'g' || line[i] == 'a' {
+		global = true
+		i++
+		if i >= len(line) {
+			return text, i - 2, false, nil
+		}
+	}
+
+	switch line[i] {
+	case 'h':
+		if dir := path.Dir(text); strings.Contains(text, "/") {
+			text = dir
+		}
+	case 't':
+		text = text[strings.LastIndexByte(text, '/')+1:]
+	case 'r':
+		if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+			text = text[:dot]
+		}
+	case 'e':
+		if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+			text = text[dot:]
+		}
+	case 'p':
+	case 'q':
+		text = "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+	case 's':
+		if i + 1 >= len(line) {
+			return "", 0, false, fmt.Errorf(":s: substitution failed")
+		}
+		delim := line[i+1]
+		var old, new string
+		old, i = readDelimited(line, i + 2, delim)
+		new, i = readDelimited(line, i, delim)
+		if old == "" {
+			old = h.Subst.Old
+			if old == "" {
+				old = search
+			}
+		}
+		h.Subst = Substitution{Old: old, New: new}
+		return h.substitute(text, global, line, i)
+	case '&':
+		return h.substitute(text, global, line, i + 1)
+	default:
+		return text, i - 1, false, nil
+	}
+
+	return text, i + 1, true, nil
+}
+
+// substitute replaces the old text of the last substitution with the new one,
+// & in the new text is the old text.
+func (h *History) substitute(text string, global bool, line string, end int) (string, int, bool, error) {
+	old := h.Subst.Old
+	if old == "" || !strings.Contains(text, old) {
+		return "", 0, false, fmt.Errorf("%s: substitution failed", line)
+	}
+
+	new := strings.ReplaceAll(h.Subst.New, `\&`, "\x00")
+	new = strings.ReplaceAll(new, "&", old)
+	new = strings.ReplaceAll(new, "\x00", "&")
+
+	if global {
+		return strings.ReplaceAll(text, old, new), end, true, nil
+	}
+	return strings.Replace(text, old, new, 1), end, true, nil
+}
+
+// readDelimited reads the text up to the delimiter or the end of the line, \ quotes the delimiter.
+// Returns the text and the index after the delimiter.
+func readDelimited(line string, i int, delim byte) (string, int) {
+	buf := strings.Builder{}
+	for ; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i + 1 < len(line) && line[i+1] == delim:
+			i++
+		case line[i] == delim:
+			return buf.String(), i + 1
+		}
+		buf.WriteByte(line[i])
+	}
+	return buf.String(), i
+}
+
+// splitWords splits the line into words for the word designators: quoted strings are
+// part of words and the operators of the shell are words of their own.
+func splitWords(line string) []string {
+	words := []string{}
+	buf := strings.Builder{}
+	var quote byte
+
+	flush := func() {
+		if buf.Len() > 0 {
+			words = append(words, buf.String())
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '\\' && i + 1 < len(line):
+			buf.WriteByte(ch)
+			i++
+			ch = line[i]
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+			continue
+		case strings.IndexByte(";&|<>()", ch) != -1:
+			flush()
+			end := i + 1
+			for end < len(line) && strings.IndexByte(";&|<>", line[end]) != -1 && ch != '(' && ch != ')' {
+				end++
+			}
+			words = append(words, line[i:end])
+			i = end - 1
+			continue
+		}
+		buf.WriteByte(ch)
+	}
+	flush()
+
+	return words
+}
+
+// relative returns the n-th line counted back from the end of the history, 1 is the last.
+func (h *History) relative(n int) (string, bool) {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	current := h.Tail
+	for ; current != nil && n > 1; n-- {
+		current = current.Prev
+	}
+	if current == nil || n < 1 {
+		return "", false
+	}
+	return current.Line, true
+}
+
+// absolute returns the line with the number n, as the history builtin prints it.
+func (h *History) absolute(n int) (string, bool) {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	n -= h.Base
+	current := h.Head
+	for i := 1; current != nil && i < n; i++ {
+		current = current.Next
+	}
+	if current == nil || n < 1 {
+		return "", false
+	}
+	return current.Line, true
+}
+
+// find returns the last line of the history that matches.
+func (h *History) find(match func(line string) bool) (string, bool) {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	for current := h.Tail; current != nil; current = current.Prev {
+		if match(current.Line) {
+			return current.Line, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,300 @@
+package history
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// History files are created 0600: the commands may contain passwords and tokens.
+const fileMode = 0600
+
+// record returns the lines of the item in a history file,
+// with the time it was entered before the command if withTime.
+// A command of several lines always has the time with the number of its lines,
+// so that it is read back as one record.
+func (item *HistoryItem) record(withTime bool) string {
+	if lines := strings.Count(item.Line, "\n") + 1; lines > 1 {
+		return fmt.Sprintf("#%d %d\n%s\n", item.Time.Unix(), lines, item.Line)
+	}
+	if withTime {
+		return fmt.Sprintf("#%d\n%s\n", item.Time.Unix(), item.Line)
+	}
+	return item.Line + "\n"
+}
+
+// ReadHistoryFromFile reads history from file and append in the end of history.
+func (h *History) ReadHistoryFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	isNewRecord := true
+	if filename == h.File() {
+		isNewRecord = false
+	}
+
+	h.pushBackRecords(string(data), isNewRecord)
+	h.setFileLines(filename, len(fileLines(string(data))))
+
+	return nil
+}
+
+// ReadNewFromFile appends the lines of the file that were not read or written yet.
+func (h *History) ReadNewFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	lines := fileLines(string(data))
+	read := min(h.FileLines[filename], len(lines))
+	h.pushBackRecords(strings.Join(lines[read:], ""), false)
+	h.setFileLines(filename, len(lines))
+
+	return nil
+}
+
+func (h *History) setFileLines(filename string, n int) {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	if h.FileLines == nil {
+		h.FileLines = make(map[string]int)
+	}
+	h.FileLines[filename] = n
+}
+
+// WriteHistoryToFIle writes history to file, replacing its contents, if it was not empty.
+// Creates a file, if it does not exist.
+// Returns the error HistoryIsEmpty, if history is empty.
+func (h *History) WriteHistoryToFile(filename string) error {
+	items, _ := h.lastItems(-1)
+	if len(items) == 0 {
+		return HistoryIsEmpty
+	}
+
+	_, unlock, err := openLocked(filename, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data := h.limitRecords(h.records(items))
+	if err := replaceFile(filename, data); err != nil {
+		return err
+	}
+	if filename == h.File() {
+		h.markSaved()
+	}
+	h.setFileLines(filename, strings.Count(data, "\n"))
+
+	return nil
+}
+
+// AppendHistoryToFile adds new records to the end of the file.
+// Creates a file, if it does not exist.
+// Returns the error NoNewRecords, if there are no new records.
+// Returns the error HistoryIsEmpty, if history is empty.
+func (h *History) AppendHistoryToFile(filename string) error {
+	f, unlock, err := openLocked(filename, os.O_APPEND | os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if h.Counter == 0 {
+		return HistoryIsEmpty
+	}
+
+	items := []HistoryItem{}
+
+	if filename == h.File() {
+		items = h.newItems()
+	} else {
+		count := h.CheckCountNewRecords()
+
+		if count == 0 {
+			return NoNewRecords
+		}
+
+		items, _ = h.lastItems(count)
+	}
+
+	written, err := appendRecords(f, h.records(items))
+	if err != nil {
+		return err
+	}
+	// the records are not appended again when the shell exits
+	if filename == h.File() {
+		h.markSaved()
+	} else {
+		h.ClearCountNewRecords()
+	}
+
+	lines, err := h.truncateFile(filename, h.FileLines[filename] + written)
+	h.setFileLines(filename, lines)
+
+	return err
+}
+
+// records returns the records in the form of the history file,
+// with the times they were entered if HISTTIMEFORMAT is set.
+func (h *History) records(items []HistoryItem) string {
+	_, withTime := h.getenv("HISTTIMEFORMAT")
+
+	buf := strings.Builder{}
+	for _, item := range items {
+		buf.WriteString(item.record(withTime))
+	}
+
+	return buf.String()
+}
+
+// truncateFile leaves the last HISTFILESIZE records in the history file.
+// Returns the number of lines in the file, lines if it was not truncated.
+func (h *History) truncateFile(filename string, lines int) (int, error) {
+	if _, ok := h.limit("HISTFILESIZE"); !ok {
+		return lines, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return lines, err
+	}
+
+	kept := h.limitRecords(string(data))
+	if len(kept) == len(data) {
+		return lines, nil
+	}
+	if err := replaceFile(filename, kept); err != nil {
+		return lines, err
+	}
+	return strings.Count(kept, "\n"), nil
+}
+
+// limitRecords returns the last HISTFILESIZE records of the history file data.
+func (h *History) limitRecords(data string) string {
+	size, ok := h.limit("HISTFILESIZE")
+	if !ok {
+		return data
+	}
+
+	records := splitRecords(data)
+	if len(records) <= size {
+		return data
+	}
+
+	return strings.Join(records[len(records)-size:], "")
+}
+
+// fileLines splits the history file data into lines with their newlines.
+// A last line without one, left by a shell that died while writing, counts as a line too.
+func fileLines(data string) []string {
+	lines := strings.SplitAfter(data, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// openLocked opens the history file, creating it if it does not exist,
+// and takes its advisory lock, waiting for other shells to release it.
+// A file replaced by another shell while waiting is opened again, its lock locks nothing.
+// Returns the func that releases the lock and closes the file.
+func openLocked(filename string, flag int) (*os.File, func(), error) {
+	for {
+		f, err := os.OpenFile(filename, os.O_CREATE | flag, fileMode)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_EX); err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s: could not lock file: %v", filename, err)
+		}
+
+		opened, errOpened := f.Stat()
+		current, errCurrent := os.Stat(filename)
+		if errOpened == nil && errCurrent == nil && !os.SameFile(opened, current) {
+			f.Close()
+			continue
+		}
+
+		return f, func() {
+			unix.Flock(int(f.Fd()), unix.LOCK_UN)
+			f.Close()
+		}, nil
+	}
+}
+
+// appendRecords appends the records to the locked history file and flushes them to the disk.
+// A last line cut short is ended first, so that the records do not stick to it.
+// Returns the number of lines of the records.
+func appendRecords(f *os.File, data string) (int, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	out := data
+	if info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size() - 1); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if last[0] != '\n' {
+			out = "\n" + data
+		}
+	}
+	if out == "" {
+		return 0, nil
+	}
+
+	if _, err := f.WriteString(out); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return strings.Count(data, "\n"), nil
+}
+
+// replaceFile writes the data to a temporary file next to the history file and renames it
+// over the file, so that a crash leaves the old contents or the new ones, never a part of them.
+func replaceFile(filename, data string) error {
+	// the link stays, the file it points to is replaced
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "." + filepath.Base(filename) + ".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(fileMode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
@@ -4,15 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/strftime"
 )
 
 var (
 	HistoryIsEmpty = errors.New("history is empty")
 	NoNewRecords   = errors.New("no new records")
+	PositionOutOfRange = errors.New("history position out of range")
 )
 
 type HistoryItem struct {
@@ -20,25 +25,53 @@ type HistoryItem struct {
 	Next 		*HistoryItem
 	Line 		string
 	IsNewRecord bool  		  // records from history mark as false(old record)
+	Time 		time.Time	  // when the command was entered
 }
 
 type History struct {
 	Head 				*HistoryItem
 	Tail 				*HistoryItem
 	Counter 			int			  // total number of records (not clear)
+	Base 				int			  // records dropped from the head for HISTSIZE, the head has the number Base+1
+	LastIgnored 		bool		  // the last line given to Add was not saved
 	CountNewRecords 	int			  // cleared then written to file (history -a <>)
 	Mu 					sync.RWMutex
+	Subst 				Substitution  // last :s/old/new/ of history expansion
+	FileLines 			map[string]int // lines of each file already read or written (history -n)
+	Getenv 				func(name string) (string, bool) // variables of the shell, os.LookupEnv if nil
+	Search 				Search		  // incremental search with Ctrl-R and Ctrl-S
+	Option 				func(name string) bool // options of the shell, all off if nil
+	DB 					string		  // history database the commands run are recorded in, none if empty
+	Session 			string		  // id of this shell in the database
 	Walk
 }
 
 type Walk struct {
 	Current *HistoryItem
+	Line 	[]rune			// line being edited, as the listener last saw it
+	Pos 	int				// cursor in Line
+	Prefix 	string			// with histprefix, Up and Down visit only the records that start with it
+	Saved 	string			// line before the walk, Down after the last record puts it back
 }
 
 func NewHistory() History {
 	return History{}
 }
 
+// getenv returns the variable of the shell, like HISTTIMEFORMAT.
+func (h *History) getenv(name string) (string, bool) {
+	if h.Getenv == nil {
+		return os.LookupEnv(name)
+	}
+	return h.Getenv(name)
+}
+
+// File returns the history file, HISTFILE of the shell, empty if it is not set.
+func (h *History) File() string {
+	filename, _ := h.getenv("HISTFILE")
+	return filename
+}
+
 // PushFrontOneLine adds one element to the front of the list.
 func (h *History) PushFrontOneLine(line string, isNewRecord bool) {
 	if line == "" {
@@ -48,6 +81,7 @@ func (h *History) PushFrontOneLine(line string, isNewRecord bool) {
 	newHead := &HistoryItem{
 		Line: line,
 		IsNewRecord: isNewRecord,
+		Time: time.Now(),
 	}
 
 	h.Mu.Lock()
@@ -64,25 +98,102 @@ func (h *History) PushFrontOneLine(line string, isNewRecord bool) {
 	h.CountNewRecords++
 }
 
-// PushFront may add few elements to the front of the list.
-func (h *History) PushFront(lines string, isNewRecord bool) int {
-	if lines == "" {
-		return 0
+// PushBackOneLine adds one element to the end of the list.
+func (h *History) PushBackOneLine(line string, isNewRecord bool) {
+	h.pushBackAt(line, isNewRecord, time.Now())
+}
+
+// Add saves the line entered by the user at the end of the list,
+// unless HISTCONTROL or HISTIGNORE tells to ignore it.
+// Returns false if the line was not saved.
+func (h *History) Add(line string) bool {
+	control, _ := h.getenv("HISTCONTROL")
+	ignoreSpace, ignoreDups, eraseDups := false, false, false
+	for _, value := range strings.Split(control, ":") {
+		switch value {
+		case "ignorespace":
+			ignoreSpace = true
+		case "ignoredups":
+			ignoreDups = true
+		case "ignoreboth":
+			ignoreSpace, ignoreDups = true, true
+		case "erasedups":
+			eraseDups = true
+		}
+	}
+
+	last, _ := h.Back()
+	h.LastIgnored = ignoreSpace && strings.HasPrefix(line, " ") ||
+		ignoreDups && line == last ||
+		h.ignored(line, last)
+	if h.LastIgnored {
+		return false
 	}
 
-	sliceLines := strings.Split(lines, "\n")
+	if eraseDups {
+		h.erase(line)
+	}
+	h.PushBackOneLine(line, true)
+	return true
+}
 
-	counter := 0
-	for _, line := range sliceLines {
-		h.PushFrontOneLine(line, isNewRecord)
-		counter++
+// ignored reports whether the line matches a pattern of HISTIGNORE,
+// in which & is the previous line.
+func (h *History) ignored(line, last string) bool {
+	patterns, _ := h.getenv("HISTIGNORE")
+	if patterns == "" {
+		return false
 	}
 
-	return counter
+	for _, pat := range strings.Split(patterns, ":") {
+		if pat == "&" {
+			if line == last {
+				return true
+			}
+			continue
+		}
+		if pat != "" && pattern.Match(pat, line) {
+			return true
+		}
+	}
+	return false
 }
 
-// PushBackOneLine adds one element to the end of the list.
-func (h *History) PushBackOneLine(line string, isNewRecord bool) {
+// erase removes the records that are the same as the line.
+func (h *History) erase(line string) {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	i := 0
+	for current := h.Tail; current != nil; current = current.Prev {
+		i++
+		if current.Line != line {
+			continue
+		}
+
+		if current.Prev != nil {
+			current.Prev.Next = current.Next
+		} else {
+			h.Head = current.Next
+		}
+		if current.Next != nil {
+			current.Next.Prev = current.Prev
+		} else {
+			h.Tail = current.Prev
+		}
+
+		h.Counter--
+		// new records are the last CountNewRecords ones
+		if i <= h.CountNewRecords {
+			h.CountNewRecords--
+		}
+		i--
+	}
+	h.Walk.Current = nil
+}
+
+// pushBackAt adds one element entered at the time t to the end of the list.
+func (h *History) pushBackAt(line string, isNewRecord bool, t time.Time) {
 	if line == "" {
 		return
 	}
@@ -90,6 +201,7 @@ func (h *History) PushBackOneLine(line string, isNewRecord bool) {
 	newTail := &HistoryItem{
 		Line: line,
 		IsNewRecord: isNewRecord,
+		Time: t,
 	}
 
 	h.Mu.Lock()
@@ -106,23 +218,157 @@ func (h *History) PushBackOneLine(line string, isNewRecord bool) {
 	h.Counter++
 	h.CountNewRecords++
 	h.Walk.Current = nil
+
+	if size, ok := h.limit("HISTSIZE"); ok {
+		h.trim(size)
+	}
 }
 
-// PushBack may adds few elements to the end of the list. 
-func (h *History) PushBack(lines string, isNewRecord bool) int {
-	if lines == "" {
-		return 0
+// trim drops records from the head, so that no more than size are left.
+// The numbers of the records that are left stay the same.
+func (h *History) trim(size int) {
+	for h.Counter > size {
+		h.Head = h.Head.Next
+		if h.Head != nil {
+			h.Head.Prev = nil
+		} else {
+			h.Tail = nil
+		}
+		h.Counter--
+		h.Base++
 	}
+	h.CountNewRecords = min(h.CountNewRecords, h.Counter)
+}
+
+// limit returns the number of records the variable like HISTSIZE allows.
+// Returns ok false if it is not set, not a number or negative, then there is no limit.
+func (h *History) limit(name string) (int, bool) {
+	value, ok := h.getenv(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Last returns the number of the last record, as the history builtin prints it.
+func (h *History) Last() int {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	return h.Base + h.Counter
+}
 
-	sliceLines := strings.Split(lines, "\n")
+// pushBackRecords adds the records of a history file to the end of the list.
+// A comment line #<seconds since epoch> before a command is the time it was entered.
+func (h *History) pushBackRecords(data string, isNewRecord bool) int {
+	records := parseRecords(data)
+	for _, record := range records {
+		h.pushBackAt(record.Line, isNewRecord, record.Time)
+	}
+
+	return len(records)
+}
+
+// parseRecords returns the commands of a history file with the times they were entered,
+// now for those without a time.
+func parseRecords(data string) []HistoryItem {
+	records := []HistoryItem{}
+	for _, record := range splitRecords(data) {
+		lines := strings.Split(strings.TrimSuffix(record, "\n"), "\n")
+
+		var t time.Time
+		for len(lines) > 0 {
+			if lines[0] == "" {
+				lines = lines[1:]
+				continue
+			}
+			stamp, n, ok := timestamp(lines[0])
+			if !ok {
+				break
+			}
+			t = stamp
+			lines = lines[1:]
+			// the lines of the command follow, even those that look like a time
+			if n > 1 {
+				break
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
 
-	counter := 0
-	for _, line := range sliceLines {
-		h.PushBackOneLine(line, isNewRecord)
-		counter++
+		if t.IsZero() {
+			t = time.Now()
+		}
+		records = append(records, HistoryItem{Line: strings.Join(lines, "\n"), Time: t})
 	}
 
-	return counter
+	return records
+}
+
+// splitRecords splits the history file data into records with their newlines.
+// A record is a command with the lines of its time and the empty lines before it.
+// A command of several lines has the number of them after its time: #<seconds since epoch> <lines>.
+func splitRecords(data string) []string {
+	records := []string{}
+	record := ""
+	more := 0	// lines of a command of several lines still to come
+	for _, line := range fileLines(data) {
+		record += line
+		if more > 0 {
+			more--
+			if more == 0 {
+				records = append(records, record)
+				record = ""
+			}
+			continue
+		}
+
+		if _, n, ok := timestamp(strings.TrimSuffix(line, "\n")); ok {
+			if n > 1 {
+				more = n
+			}
+			continue
+		}
+		if line == "\n" {
+			continue
+		}
+
+		records = append(records, record)
+		record = ""
+	}
+	// the first lines of a command cut short by a crash
+	if more > 0 {
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// timestamp parses the line #<seconds since epoch> of a history file,
+// with the number of lines of the command after it, 1 if it is not there.
+func timestamp(line string) (time.Time, int, bool) {
+	if len(line) < 2 || line[0] != '#' {
+		return time.Time{}, 0, false
+	}
+	stamp, count, hasCount := strings.Cut(line[1:], " ")
+	sec, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	lines := 1
+	if hasCount {
+		lines, err = strconv.Atoi(count)
+		if err != nil || lines < 1 {
+			return time.Time{}, 0, false
+		}
+	}
+	return time.Unix(sec, 0), lines, true
 }
 
 // Front returns first element and true in the list.
@@ -161,11 +407,6 @@ func (h *History) ReadFromHead() []string {
 
 	sliceLines := make([]string, 0, 1)
 
-	if h.Head.Next == nil {
-		sliceLines = append(sliceLines, h.Head.Line)
-	}
-
-
 	current := h.Head
 	for current != nil {
 		sliceLines = append(sliceLines, current.Line)
@@ -202,19 +443,22 @@ func (h *History) FindAndReadNewRecords() []string {
 
 // ReadHistoryWithFormat is a wrapper for output to return all entries in history of the format.
 func (h *History) ReadHistoryWithFormat() string {
-	sliceLines := h.ReadFromHead()
-	if sliceLines == nil {
-		return ""
-	}
-
-	return PrintHistoryWithFormatASC(sliceLines, 1)
+	items, first := h.lastItems(-1)
+	return h.formatItems(items, first)
 }
 
-// PrintHistoryWithFormatASC returns records in the format(without quotes): "    1  echo hello\n".
-func PrintHistoryWithFormatASC(sliceLines []string, i int) string {
+// formatItems returns records in the format(without quotes): "    1  echo hello\n",
+// if HISTTIMEFORMAT is set, the time formatted with it is before the command.
+func (h *History) formatItems(items []HistoryItem, i int) string {
+	timeFormat, withTime := h.getenv("HISTTIMEFORMAT")
+
 	buf := strings.Builder{}
-	for _, line := range sliceLines {
-		buf.WriteString(fmt.Sprintf("    %d  %s\n", i, line))
+	for _, item := range items {
+		stamp := ""
+		if withTime {
+			stamp = strftime.Format(timeFormat, item.Time)
+		}
+		buf.WriteString(fmt.Sprintf("    %d  %s%s\n", i, stamp, item.Line))
 		i++
 	}
 
@@ -223,17 +467,51 @@ func PrintHistoryWithFormatASC(sliceLines []string, i int) string {
 
 // ReadHistoryLastNWithFormat is a wrapper for output to return Last N entries in history of the format.
 func (h *History) ReadHistoryLastNWithFormat(n int) (string, error) {
-	sliceLines, err := h.ReadFromTailLastN(n)
-	if err != nil {
-		return "", err
+	if n < 0 {
+		return "", fmt.Errorf("invalid n")
+	}
+
+	items, first := h.lastItems(n)
+	return h.formatItems(items, first), nil
+}
+
+// lastItems returns copies of the last n records, all of them if n is negative,
+// and the number of the first one.
+func (h *History) lastItems(n int) ([]HistoryItem, int) {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	if n < 0 || n > h.Counter {
+		n = h.Counter
+	}
+
+	current := h.Tail
+	for i := 1; i < n; i++ {
+		current = current.Prev
 	}
-	if sliceLines == nil {
-		return "", err
+
+	items := make([]HistoryItem, 0, n)
+	for ; n > 0 && current != nil; current = current.Next {
+		items = append(items, *current)
+	}
+
+	return items, h.Base + h.Counter - n + 1
+}
+
+// newItems returns copies of the records that are not from the history file.
+func (h *History) newItems() []HistoryItem {
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	items := []HistoryItem{}
+	for current := h.Head; current != nil; current = current.Next {
+		if current.IsNewRecord {
+			items = append(items, *current)
+		}
 	}
 
-	i:= h.Counter - n + 1
-	return PrintHistoryWithFormatASC(sliceLines, i), nil
-} 
+	return items
+}
 
 // ReadFromTailLastN returns last n records from history in slice.
 // If N is greater than the total number of records, it will be called ReadFromHead.
@@ -319,56 +597,97 @@ func (h *History) WalkByHistory(line []rune, pos int, key rune) (newLine []rune,
 	// fmt.Printf("key: %q, inESC: %v, buf: %q\n", key, h.Walk.InESC, string(h.Walk.Buf))
 	switch key {
 	case readline.CharPrev: // 16 \x10
-		return h.handleUp()
+		newLine, newPos, ok = h.handleUp()
 	case readline.CharNext: // 14 \x0e
-		return h.handleDown()
-	default:
-		return nil, 0, false
+		newLine, newPos, ok = h.handleDown()
+	}
+
+	// the line readline shows is its own history, so the line stays as it was
+	if !ok && (key == readline.CharPrev || key == readline.CharNext) {
+		newLine, newPos, ok = h.Walk.Line, h.Walk.Pos, true
 	}
+
+	if ok {
+		h.Walk.Line, h.Walk.Pos = append([]rune(nil), newLine...), newPos
+	} else {
+		h.Walk.Line, h.Walk.Pos = line, pos
+	}
+	return newLine, newPos, ok
+}
+
+// option reports whether the option of the shell is on.
+func (h *History) option(name string) bool {
+	return h.Option != nil && h.Option(name)
+}
+
+// visits reports whether Up and Down stop at the record: with histprefix it starts with the prefix,
+// with histnodups it is not the same as the line shown.
+func (h *History) visits(item *HistoryItem) bool {
+	return strings.HasPrefix(item.Line, h.Walk.Prefix) &&
+		!(h.option("histnodups") && item.Line == string(h.Walk.Line))
+}
+
+// show returns the line of the record with the cursor after the prefix, at the end if there is none.
+func (h *History) show(line string) ([]rune, int, bool) {
+	runes := []rune(line)
+	if h.Walk.Prefix != "" {
+		return runes, len([]rune(h.Walk.Prefix)), true
+	}
+	return runes, len(runes), true
 }
 
 func (h *History) handleUp() (newLine []rune, newPos int, ok bool) {
 	h.Mu.Lock()
 	defer h.Mu.Unlock()
 
+	// the text before the cursor is the prefix, until the walk ends
 	if h.Current == nil {
-		h.Current = h.Tail
-		if h.Current != nil {
-			line := []rune(h.Current.Line)
-			return line, len(line), true
+		h.Walk.Prefix = ""
+		if h.option("histprefix") {
+			h.Walk.Prefix = string(h.Walk.Line[:h.Walk.Pos])
 		}
+		h.Walk.Saved = string(h.Walk.Line)
 	}
 
+	next := h.Tail
 	if h.Current != nil {
-		if h.Current.Prev != nil {
-			h.Current = h.Current.Prev
-			line := []rune(h.Current.Line)
-			return line, len(line), true
-		}
+		next = h.Current.Prev
+	}
+	for next != nil && !h.visits(next) {
+		next = next.Prev
+	}
+	if next == nil {
+		return nil, 0, false
 	}
 
-	return nil, 0, false
+	h.Current = next
+	return h.show(next.Line)
 }
 
 func (h *History) handleDown() (newLine []rune, newPos int, ok bool) {
 	h.Mu.Lock()
 	defer h.Mu.Unlock()
 	if h.Current == nil {
-		h.Current = h.Tail
+		if h.option("histprefix") {
+			return nil, 0, false
+		}
+		return []rune(""), 0, true
 	}
 
-	if h.Current != nil {
-		if h.Current.Next != nil {
-			h.Current = h.Current.Next
-			line := []rune(h.Current.Line)
-			return line, len(line), true
-		} else {
-			h.Current = nil
+	next := h.Current.Next
+	for next != nil && !h.visits(next) {
+		next = next.Next
+	}
+
+	// after the last record is the line typed before the walk
+	h.Current = next
+	if next == nil {
+		if h.Walk.Prefix == "" {
 			return []rune(""), 0, true
 		}
+		return h.show(h.Walk.Saved)
 	}
-
-	return nil, 0, false
+	return h.show(next.Line)
 }
 
 func(h *History) ClearCountNewRecords() {
@@ -383,86 +702,60 @@ func(h *History) CheckCountNewRecords() int {
 	return h.CountNewRecords
 }
 
-// ReadHistoryFromFile reads history from file and append in the end of history.
-func (h *History) ReadHistoryFromFile(filename string) error {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return err
-	}
-
-	isNewRecord := true
-	if filename == os.Getenv("HISTFILE") {
-		isNewRecord = false
-	}
-
-	h.PushBack(string(data), isNewRecord)
+// Clear removes all records from history.
+func (h *History) Clear() {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
 
-	return nil
+	h.Head = nil
+	h.Tail = nil
+	h.Counter = 0
+	h.Base = 0
+	h.CountNewRecords = 0
+	h.Walk.Current = nil
 }
 
-// WriteHistoryToFIle writes history to file, overwriting its contents, if it was not empty.
-// Creates a file, if it does not exist.
-// Returns the error HistoryIsEmpty, if history is empty.
-func (h *History) WriteHistoryToFile(filename string) error {
-	f, err := os.OpenFile(filename, os.O_CREATE | os.O_RDWR, 0766)
-	if err != nil {
-		return fmt.Errorf("could not open file")
-	}
-	defer f.Close()
+// DeleteRange removes the records with numbers from start to end, as the history command prints them.
+// Returns the error PositionOutOfRange, if a number is not in history.
+func (h *History) DeleteRange(start, end int) error {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
 
-	sliceLines := h.ReadFromHead()
-	if sliceLines == nil {
-		return HistoryIsEmpty
+	start, end = start - h.Base, end - h.Base
+	if start < 1 || end > h.Counter || start > end {
+		return PositionOutOfRange
 	}
 
-	for _, line := range sliceLines {
-		f.WriteString(line + "\n")
+	first := h.Head
+	for i := 1; i < start; i++ {
+		first = first.Next
 	}
-
-	return nil
-}
-
-// AppendHistoryToFile adds new records to the end of the file.
-// Creates a file, if it does not exist.
-// Returns the error NoNewRecords, if there are no new records.
-// Returns the error HistoryIsEmpty, if history is empty.
-func (h *History) AppendHistoryToFile(filename string) error {
-	f, err := os.OpenFile(filename, os.O_CREATE | os.O_APPEND | os.O_RDWR, 0766)
-	if err != nil {
-		return fmt.Errorf("could not open file")
+	last := first
+	for i := start; i < end; i++ {
+		last = last.Next
 	}
-	defer f.Close()
 
-	sliceLines := []string{}
-
-	if filename == os.Getenv("HISTFILE") {
-		sliceLines = h.FindAndReadNewRecords()
+	if first.Prev != nil {
+		first.Prev.Next = last.Next
 	} else {
-		count := h.CheckCountNewRecords()
-
-		if count == 0 {
-			return NoNewRecords
-		}
-		
-		sliceLines, err = h.ReadFromTailLastN(count)
-		if err != nil {
-			return err
-		}
-
-		h.ClearCountNewRecords()
+		h.Head = last.Next
 	}
-
-	if sliceLines == nil {
-		return HistoryIsEmpty
+	if last.Next != nil {
+		last.Next.Prev = first.Prev
+	} else {
+		h.Tail = first.Prev
 	}
 
-	for _, line := range sliceLines {
-		f.WriteString(line + "\n")
-	}
+	// new records are at the end, the deleted ones may have been among them
+	deleted := end - start + 1
+	h.Counter -= deleted
+	h.CountNewRecords = max(0, min(h.CountNewRecords, h.Counter - start + 1))
+	h.Walk.Current = nil
 
 	return nil
 }
 
-// Todo
-// // delete First
-// // delete Last
\ No newline at end of file
+// Delete removes the record with the number n.
+func (h *History) Delete(n int) error {
+	return h.DeleteRange(n, n)
+}
\ No newline at end of file
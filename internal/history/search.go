@@ -0,0 +1,182 @@
+package history
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chzyer/readline"
+)
+
+// Editor is the line editor the incremental search shows its state in.
+type Editor interface {
+	Prompt() string
+	SetPrompt(prompt string)
+	SetBuffer(line string)
+}
+
+// Search is the state of the incremental search started by Ctrl-R or Ctrl-S.
+type Search struct {
+	Active 	bool
+	Forward bool
+	Failed 	bool				// nothing matches the query
+	Query 	[]rune
+	match 	*HistoryItem		// record shown, nil for the line being edited
+	at 		int					// start of the query in the match, in runes
+	prompt 	string				// prompt before the search
+	line 	string				// line before the search, Ctrl-G puts it back
+	last 	[]rune				// query of the previous search, Ctrl-R at once repeats it
+}
+
+// SearchFilter returns the FuncFilterInputRune of readline that runs the incremental search.
+// While it is active, the keys edit the query. Enter, arrows and other control keys
+// accept the match and do their usual work, Ctrl-G puts back the line before the search.
+func (h *History) SearchFilter(ed Editor) func(r rune) (rune, bool) {
+	return func(r rune) (rune, bool) {
+		s := &h.Search
+		if !s.Active {
+			if r != readline.CharBckSearch && r != readline.CharFwdSearch {
+				return r, true
+			}
+
+			h.Search = Search{
+				Active: true,
+				Forward: r == readline.CharFwdSearch,
+				prompt: ed.Prompt(),
+				line: string(h.Walk.Line),
+				last: s.last,
+			}
+			h.showSearch(ed)
+			return r, false
+		}
+
+		switch {
+		case r == readline.CharBckSearch || r == readline.CharFwdSearch:
+			s.Forward = r == readline.CharFwdSearch
+			if len(s.Query) == 0 {
+				s.Query = append(s.Query, s.last...)
+				h.searchFrom(s.match, true)
+			} else {
+				h.searchFrom(s.match, false)
+			}
+		case r == readline.CharBackspace || r == readline.CharCtrlH:
+			if len(s.Query) > 0 {
+				s.Query = s.Query[:len(s.Query)-1]
+			}
+			// again from the line where the search started
+			s.match = nil
+			h.searchFrom(nil, false)
+		case r == readline.CharBell:
+			h.endSearch(ed, false)
+			return r, false
+		case r >= ' ':
+			s.Query = append(s.Query, r)
+			h.searchFrom(s.match, true)
+		default:
+			h.endSearch(ed, r != readline.CharInterrupt)
+			return r, true
+		}
+
+		h.showSearch(ed)
+		return r, false
+	}
+}
+
+// searchFrom finds the query starting at the record, nil for the line being edited.
+// The record itself is checked only if inclusive. If nothing matches, the match stays.
+func (h *History) searchFrom(from *HistoryItem, inclusive bool) {
+	s := &h.Search
+	if len(s.Query) == 0 {
+		s.Failed = false
+		return
+	}
+
+	h.Mu.RLock()
+	defer h.Mu.RUnlock()
+
+	current := from
+	switch {
+	case current == nil && !s.Forward:
+		current = h.Tail
+	case current == nil:
+		// nothing is newer than the line being edited
+	case !inclusive && s.Forward:
+		current = current.Next
+	case !inclusive:
+		current = current.Prev
+	}
+
+	query := string(s.Query)
+	for current != nil {
+		if at := strings.LastIndex(current.Line, query); at != -1 {
+			s.match = current
+			s.at = len([]rune(current.Line[:at]))
+			s.Failed = false
+			return
+		}
+
+		if s.Forward {
+			current = current.Next
+		} else {
+			current = current.Prev
+		}
+	}
+	s.Failed = true
+}
+
+// showSearch shows the query in the prompt and the match in the line.
+func (h *History) showSearch(ed Editor) {
+	s := &h.Search
+
+	label := "reverse-i-search"
+	if s.Forward {
+		label = "i-search"
+	}
+	if s.Failed {
+		label = "failed " + label
+	}
+	ed.SetPrompt(fmt.Sprintf("(%s)'%s': ", label, string(s.Query)))
+
+	if s.match != nil {
+		ed.SetBuffer(s.match.Line)
+	} else {
+		ed.SetBuffer(s.line)
+	}
+}
+
+// endSearch leaves the incremental search. If accept, the match stays in the line
+// and Up and Down go on from it, otherwise the line before the search is put back.
+func (h *History) endSearch(ed Editor, accept bool) {
+	s := &h.Search
+	s.Active = false
+	s.last = s.Query
+
+	ed.SetPrompt(s.prompt)
+	if !accept {
+		ed.SetBuffer(s.line)
+		return
+	}
+	if s.match != nil {
+		h.Mu.Lock()
+		h.Walk.Current = s.match
+		h.Walk.Prefix = ""
+		h.Mu.Unlock()
+	}
+}
+
+// Paint is the readline.Painter that highlights the match of the incremental search.
+func (h *History) Paint(line []rune, pos int) []rune {
+	s := &h.Search
+	if !s.Active || s.Failed || s.match == nil || len(s.Query) == 0 || string(line) != s.match.Line {
+		return line
+	}
+
+	end := s.at + len(s.Query)
+	painted := make([]rune, 0, len(line) + 8)
+	painted = append(painted, line[:s.at]...)
+	painted = append(painted, []rune("\033[7m")...)
+	painted = append(painted, line[s.at:end]...)
+	painted = append(painted, []rune("\033[0m")...)
+	painted = append(painted, line[end:]...)
+
+	return painted
+}
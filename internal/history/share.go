@@ -0,0 +1,91 @@
+package history
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// SyncFile shares history with other shells through the history file: the records they appended
+// since the last time are added before the new records of this shell, which are then appended.
+// So the file gets the commands of all shells and Up still shows the own ones in the order they were entered.
+func (h *History) SyncFile(filename string) error {
+	f, unlock, err := openLocked(filename, os.O_APPEND | os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	lines := fileLines(string(data))
+
+	read := min(h.FileLines[filename], len(lines))
+	h.insertRecords(parseRecords(strings.Join(lines[read:], "")))
+
+	written, err := appendRecords(f, h.records(h.newItems()))
+	if err != nil {
+		return err
+	}
+	h.markSaved()
+
+	total, err := h.truncateFile(filename, len(lines) + written)
+	h.setFileLines(filename, total)
+
+	return err
+}
+
+// insertRecords adds the records of other shells before the first new record,
+// at the end if there are none.
+func (h *History) insertRecords(records []HistoryItem) {
+	if len(records) == 0 {
+		return
+	}
+
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	before := h.Head
+	for before != nil && !before.IsNewRecord {
+		before = before.Next
+	}
+
+	for _, record := range records {
+		item := &HistoryItem{
+			Line: record.Line,
+			Time: record.Time,
+		}
+
+		item.Next = before
+		if before != nil {
+			item.Prev = before.Prev
+			before.Prev = item
+		} else {
+			item.Prev = h.Tail
+			h.Tail = item
+		}
+		if item.Prev != nil {
+			item.Prev.Next = item
+		} else {
+			h.Head = item
+		}
+		h.Counter++
+	}
+	h.Walk.Current = nil
+
+	if size, ok := h.limit("HISTSIZE"); ok {
+		h.trim(size)
+	}
+}
+
+// markSaved marks the new records as written to the history file.
+func (h *History) markSaved() {
+	h.Mu.Lock()
+	defer h.Mu.Unlock()
+
+	for current := h.Head; current != nil; current = current.Next {
+		current.IsNewRecord = false
+	}
+}
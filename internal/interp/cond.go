@@ -0,0 +1,116 @@
+package interp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/cond"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+// runCond runs [[ ]], the status is 0 if the expression is true, 1 if false and 2 on errors.
+func (r *Runner) runCond(c *ast.CondCmd, s cmd.Streams) error {
+	ok, err := r.evalCond(c.Expr, s)
+	switch {
+	case err != nil:
+		return r.failed(s, 2, err)
+	case ok:
+		r.Sh.Status = 0
+	default:
+		r.Sh.Status = 1
+	}
+	return nil
+}
+
+// evalCond evaluates the expression of [[ ]], each test is traced with set -x.
+func (r *Runner) evalCond(e *ast.CondExpr, s cmd.Streams) (bool, error) {
+	switch e.Op {
+	case "&&", "||":
+		x, err := r.evalCond(e.X, s)
+		if err != nil || x == (e.Op == "||") {
+			return x, err
+		}
+		return r.evalCond(e.Y, s)
+	case "!":
+		x, err := r.evalCond(e.X, s)
+		return !x, err
+	case "(":
+		return r.evalCond(e.X, s)
+	}
+
+	// no word splitting and globbing,
+	// the right operand of == is a pattern and of =~ a regular expression
+	x, err := r.exp.Literal(e.Words[0])
+	if err != nil {
+		return false, err
+	}
+	y := ""
+	if len(e.Words) > 1 {
+		switch e.Op {
+		case "=", "==", "!=":
+			y, err = r.exp.Pattern(e.Words[1])
+		case "=~":
+			y, err = r.exp.Regexp(e.Words[1])
+		default:
+			y, err = r.exp.Literal(e.Words[1])
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case e.Op == "":
+		r.trace(s, "[[", cmd.QuoteValue(x), "]]")
+	case len(e.Words) == 1:
+		r.trace(s, "[[", e.Op, cmd.QuoteValue(x), "]]")
+	default:
+		r.trace(s, "[[", cmd.QuoteValue(x), e.Op, y, "]]")
+	}
+
+	switch e.Op {
+	case "":
+		return x != "", nil
+	case "=", "==", "!=":
+		return pattern.Match(y, x) == (e.Op != "!="), nil
+	case "=~":
+		return r.matchRegexp(x, y)
+	case "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+		// the operands are arithmetic expressions
+		a, err := arith.Eval(x, r.Sh)
+		if err != nil {
+			return false, err
+		}
+		b, err := arith.Eval(y, r.Sh)
+		if err != nil {
+			return false, err
+		}
+		return cond.Binary(e.Op, strconv.FormatInt(a, 10), strconv.FormatInt(b, 10), r.Sh)
+	}
+
+	if len(e.Words) == 1 {
+		return cond.Unary(e.Op, x, r.Sh)
+	}
+	return cond.Binary(e.Op, x, y, r.Sh)
+}
+
+// matchRegexp matches the string against the extended regular expression and
+// saves the match and its groups in BASH_REMATCH.
+func (r *Runner) matchRegexp(x, expr string) (bool, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid regular expression", expr)
+	}
+
+	match := re.FindStringSubmatch(x)
+	if match == nil {
+		r.Sh.SetArray("BASH_REMATCH", nil)
+		return false, nil
+	}
+	r.Sh.SetArray("BASH_REMATCH", match)
+	return true, nil
+}
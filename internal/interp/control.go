@@ -0,0 +1,236 @@
+package interp
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/utils/pattern"
+)
+
+func (r *Runner) runIf(c *ast.IfCmd, s cmd.Streams) error {
+	for i, cond := range c.Conds {
+		if err := r.condition(cond, s); err != nil {
+			return err
+		}
+		if r.Sh.Status == 0 {
+			return r.runList(c.Thens[i], s)
+		}
+	}
+
+	if c.Else != nil {
+		return r.runList(c.Else, s)
+	}
+
+	r.Sh.Status = 0
+	return nil
+}
+
+// loopControl handles break and continue that came out of the body of a loop.
+// Returns stop if the loop has to end and the error for the outer loops.
+func loopControl(err error) (stop bool, outer error) {
+	var breakErr *cmd.BreakError
+	if errors.As(err, &breakErr) {
+		if breakErr.N > 1 {
+			return true, &cmd.BreakError{N: breakErr.N - 1}
+		}
+		return true, nil
+	}
+
+	var continueErr *cmd.ContinueError
+	if errors.As(err, &continueErr) {
+		if continueErr.N > 1 {
+			return true, &cmd.ContinueError{N: continueErr.N - 1}
+		}
+		return false, nil
+	}
+
+	return err != nil, err
+}
+
+func (r *Runner) runWhile(c *ast.WhileCmd, s cmd.Streams) error {
+	r.loops++
+	defer func() { r.loops-- }()
+
+	status := 0
+
+	for {
+		if err := r.condition(c.Cond, s); err != nil {
+			if stop, outer := loopControl(err); stop {
+				r.Sh.Status = status
+				return outer
+			}
+			continue
+		}
+		if (r.Sh.Status == 0) == c.Until {
+			break
+		}
+
+		err := r.runList(c.Body, s)
+		status = r.Sh.Status
+		if stop, outer := loopControl(err); stop {
+			r.Sh.Status = status
+			return outer
+		}
+	}
+
+	r.Sh.Status = status
+	return nil
+}
+
+func (r *Runner) runFor(c *ast.ForCmd, s cmd.Streams) error {
+	// the words are traced as they are written, like bash does
+	list := `"$@"`
+	words := r.Sh.Params
+	if c.HasIn {
+		list = strings.Join(c.Words, " ")
+		var err error
+		words, err = r.exp.Fields(c.Words)
+		if err != nil {
+			return r.failed(s, 1, err)
+		}
+	}
+
+	r.loops++
+	defer func() { r.loops-- }()
+
+	status := 0
+	for _, word := range words {
+		r.trace(s, "for", c.Var, "in", list)
+		if err := r.Sh.Set(c.Var, word); err != nil {
+			return r.failed(s, 1, err)
+		}
+
+		err := r.runList(c.Body, s)
+		status = r.Sh.Status
+		if stop, outer := loopControl(err); stop {
+			r.Sh.Status = status
+			return outer
+		}
+	}
+
+	r.Sh.Status = status
+	return nil
+}
+
+// arith expands and evaluates the expression, an error is printed and gives ok false.
+func (r *Runner) arith(expr string, s cmd.Streams) (n int64, ok bool) {
+	expr, err := r.exp.Literal(expr)
+	if err != nil {
+		r.errorf(s, 1, "%v", err)
+		return 0, false
+	}
+	r.trace(s, "((", expr, "))")
+
+	n, err = arith.Eval(expr, r.Sh)
+	if err != nil {
+		r.errorf(s, 1, "%v", err)
+		return 0, false
+	}
+	return n, true
+}
+
+// runArith runs (( )), the status is 0 if the value is not zero.
+func (r *Runner) runArith(c *ast.ArithCmd, s cmd.Streams) error {
+	n, ok := r.arith(c.Expr, s)
+	if !ok {
+		return nil
+	}
+
+	if n != 0 {
+		r.Sh.Status = 0
+	} else {
+		r.Sh.Status = 1
+	}
+	return nil
+}
+
+func (r *Runner) runArithFor(c *ast.ArithForCmd, s cmd.Streams) error {
+	r.loops++
+	defer func() { r.loops-- }()
+
+	if _, ok := r.arith(c.Init, s); !ok {
+		return nil
+	}
+
+	status := 0
+	for {
+		// empty condition is true
+		if c.Cond != "" {
+			n, ok := r.arith(c.Cond, s)
+			if !ok {
+				return nil
+			}
+			if n == 0 {
+				break
+			}
+		}
+
+		err := r.runList(c.Body, s)
+		status = r.Sh.Status
+		if stop, outer := loopControl(err); stop {
+			r.Sh.Status = status
+			return outer
+		}
+
+		if _, ok := r.arith(c.Post, s); !ok {
+			return nil
+		}
+	}
+
+	r.Sh.Status = status
+	return nil
+}
+
+func (r *Runner) runCase(c *ast.CaseCmd, s cmd.Streams) error {
+	r.trace(s, "case", c.Word, "in")
+	word, err := r.exp.Literal(c.Word)
+	if err != nil {
+		return r.failed(s, 1, err)
+	}
+
+	r.Sh.Status = 0
+	fallThrough := false
+
+	for _, item := range c.Items {
+		if !fallThrough {
+			matched, err := r.caseMatch(item, word)
+			if err != nil {
+				return r.failed(s, 1, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if err := r.runList(item.Body, s); err != nil {
+			return err
+		}
+
+		switch item.Term {
+		case ";&":
+			fallThrough = true
+		case ";;&":
+			fallThrough = false
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) caseMatch(item *ast.CaseItem, word string) (bool, error) {
+	for _, pat := range item.Patterns {
+		expanded, err := r.exp.Pattern(pat)
+		if err != nil {
+			return false, err
+		}
+		if pattern.Match(expanded, word) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,41 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+)
+
+// calls of functions inside each other, deeper recursion is an error
+const maxFuncDepth = 1000
+
+// callFunction runs the body of the function with the arguments as positional parameters.
+func (r *Runner) callFunction(fn *ast.FuncDecl, cc *cmd.CurrentCmd) error {
+	if len(cc.Shell.Frames) >= maxFuncDepth {
+		return fmt.Errorf("%s: maximum function nesting level exceeded (%d)", fn.Name, maxFuncDepth)
+	}
+
+	end := r.Sh.Call(fn.Name, cc.Args)
+	defer end()
+
+	// break and continue in the function don't leave the loops of its caller
+	loops := r.loops
+	r.loops = 0
+	defer func() { r.loops = loops }()
+
+	err := r.runCommand(fn.Body, cc.Streams)
+
+	var returnErr *cmd.ReturnError
+	if errors.As(err, &returnErr) {
+		r.Sh.Status = returnErr.Code
+	} else if err != nil {
+		return err
+	}
+
+	if r.Sh.Status != 0 {
+		return &cmd.StatusError{Code: r.Sh.Status}
+	}
+	return nil
+}
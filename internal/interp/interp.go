@@ -0,0 +1,671 @@
+package interp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/expand"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+	"github.com/codecrafters-io/shell-starter-go/internal/pipeline"
+	"github.com/codecrafters-io/shell-starter-go/internal/state"
+)
+
+// Runner executes parsed commands in the shell state Sh.
+type Runner struct {
+	Sh  		*state.Shell
+	exp 		*expand.Expander
+	substStatus int				// status of the last command substitution, -1 if none
+	noErrexit 	int				// > 0 in conditions, where a failed command doesn't exit with set -e
+	procSubsts 	[]*procSubst	// process substitutions of the running commands
+	loops 		int				// loops around the running command in this shell or function
+	traceLevel 	int				// command and process substitutions the runner is in, set -x repeats the first character of PS4 for each
+	isSubshell 	bool			// a write to a closed pipe ends it, like SIGPIPE ends a process
+}
+
+func NewRunner(sh *state.Shell) *Runner {
+	r := &Runner{
+		Sh: sh,
+		exp: &expand.Expander{Sh: sh},
+		substStatus: -1,
+	}
+	r.exp.Subst = r.substitute
+	r.exp.ProcSubst = r.processSubst
+
+	return r
+}
+
+// subshell returns a runner with a copy of the state,
+// its changes don't affect the current shell.
+func (r *Runner) subshell() *Runner {
+	sub := NewRunner(r.Sh.Clone())
+	sub.noErrexit = r.noErrexit
+	sub.traceLevel = r.traceLevel
+	sub.isSubshell = true
+	return sub
+}
+
+// Run runs the commands with the standard streams of the process.
+// Returns *cmd.ExitError if the shell has to exit.
+func (r *Runner) Run(list *ast.List) error {
+	streams := cmd.Streams{
+		Stdin: os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	err := r.runList(list, streams)
+
+	var exitErr *cmd.ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+
+	// an aborted line ends here, only exit ends the shell
+	return nil
+}
+
+// errorf prints the error of the shell itself and sets the exit status.
+func (r *Runner) errorf(s cmd.Streams, status int, format string, args ...any) {
+	fmt.Fprintf(s.Stderr, format + "\n", args...)
+	r.Sh.Status = status
+}
+
+// failed prints the error of the shell itself and sets the exit status like errorf.
+// A shell that is not interactive exits on errors of parameters that are not set
+// and of arithmetic expansions.
+//
+// An arithmetic expansion error ends more than the command, as in bash 5.2:
+// bash -c 'echo $((2**-1)); echo after' exits with 1 before the echo, and so do
+// scripts. An interactive shell only drops the rest of the line and reads the next one.
+func (r *Runner) failed(s cmd.Streams, status int, err error) error {
+	var paramErr *expand.ParamError
+	if errors.As(err, &paramErr) && !r.Sh.Interactive {
+		// like bash, the status is 1 with set -e
+		code := 127
+		if r.Sh.Option("errexit") {
+			code = 1
+		}
+		r.errorf(s, code, "%v", err)
+		return &cmd.ExitError{Code: code}
+	}
+
+	var arithErr *expand.ArithError
+	if errors.As(err, &arithErr) {
+		r.errorf(s, 1, "%v", err)
+		if r.Sh.Interactive {
+			return &cmd.AbortError{Code: 1}
+		}
+		return &cmd.ExitError{Code: 1}
+	}
+
+	r.errorf(s, status, "%v", err)
+	return nil
+}
+
+func (r *Runner) runList(list *ast.List, s cmd.Streams) error {
+	for _, andOr := range list.Items {
+		if andOr.Background {
+			r.runBackground(andOr, s)
+			continue
+		}
+
+		if err := r.runAndOr(andOr, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBackground starts the commands without waiting for them.
+func (r *Runner) runBackground(andOr *ast.AndOr, s cmd.Streams) {
+	sub := r.subshell()
+	r.Sh.LastJob = state.NewJob()
+
+	go sub.runAndOr(andOr, s)
+
+	r.Sh.Status = 0
+}
+
+func (r *Runner) runAndOr(andOr *ast.AndOr, s cmd.Streams) error {
+	last := len(andOr.Pipelines) - 1
+	for i, p := range andOr.Pipelines {
+		if i > 0 {
+			op := andOr.Ops[i-1]
+			if (op == "&&" && r.Sh.Status != 0) || (op == "||" && r.Sh.Status == 0) {
+				continue
+			}
+		}
+
+		// only the last command of && and || lists exits with set -e
+		tested := i < last || p.Negate
+		if tested {
+			r.noErrexit++
+		}
+		err := r.runPipeline(p, s)
+		if tested {
+			r.noErrexit--
+		}
+		if err != nil {
+			return err
+		}
+
+		if !tested && r.errexit(p) {
+			return &cmd.ExitError{Code: r.Sh.Status}
+		}
+	}
+	return nil
+}
+
+// errexit reports whether the shell has to exit with set -e after the pipeline failed.
+// Compound commands other than subshells don't exit themselves, only the commands in them.
+func (r *Runner) errexit(p *ast.Pipeline) bool {
+	if r.Sh.Status == 0 || r.noErrexit > 0 || !r.Sh.Option("errexit") {
+		return false
+	}
+
+	if len(p.Cmds) == 1 {
+		switch p.Cmds[0].(type) {
+		case *ast.Group, *ast.IfCmd, *ast.WhileCmd, *ast.ForCmd, *ast.ArithForCmd, *ast.CaseCmd:
+			return false
+		}
+	}
+	return true
+}
+
+// condition runs the commands of a condition, in which set -e is ignored.
+func (r *Runner) condition(list *ast.List, s cmd.Streams) error {
+	r.noErrexit++
+	defer func() { r.noErrexit-- }()
+
+	return r.runList(list, s)
+}
+
+func (r *Runner) runPipeline(p *ast.Pipeline, s cmd.Streams) error {
+	if len(p.Cmds) == 1 {
+		if err := r.runCommand(p.Cmds[0], s); err != nil {
+			return err
+		}
+	} else {
+		r.Sh.Status = r.execPipeline(p, s)
+	}
+
+	if p.Negate {
+		if r.Sh.Status == 0 {
+			r.Sh.Status = 1
+		} else {
+			r.Sh.Status = 0
+		}
+	}
+
+	return nil
+}
+
+// execPipeline runs every command in a subshell connected with pipes,
+// returns the exit status of the last command.
+func (r *Runner) execPipeline(p *ast.Pipeline, s cmd.Streams) int {
+	c := pipeline.Cmds{
+		Stages: make([]pipeline.Stage, 0, len(p.Cmds)),
+		CountCmd: len(p.Cmds),
+		Stdin: s.Stdin,
+		Stdout: s.Stdout,
+		Stderr: s.Stderr,
+	}
+
+	for _, command := range p.Cmds {
+		sub := r.subshell()
+		c.Stages = append(c.Stages, func(stdin io.Reader, stdout io.Writer) int {
+			stageStreams := s.WithRedirections(nil)
+			stageStreams.Stdin = stdin
+			stageStreams.Stdout = stdout
+
+			err := sub.runCommand(command, stageStreams)
+
+			var exitErr *cmd.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.Code
+			}
+			return sub.Sh.Status
+		})
+	}
+
+	statuses := c.ExecPipeline()
+
+	// with pipefail the status is of the last command that failed
+	if r.Sh.Option("pipefail") {
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if statuses[i] != 0 {
+				return statuses[i]
+			}
+		}
+	}
+	return statuses[len(statuses)-1]
+}
+
+func (r *Runner) runCommand(command ast.Command, s cmd.Streams) error {
+	switch c := command.(type) {
+	case *ast.SimpleCmd:
+		return r.runSimple(c, s)
+	case *ast.FuncDecl:
+		r.Sh.DefineFunc(c)
+		r.Sh.Status = 0
+		return nil
+	}
+
+	// process substitutions live until the command ends
+	defer r.endProcSubsts(len(r.procSubsts))
+
+	redirections, err := r.redirections(command.Redirects())
+	if err != nil {
+		return r.failed(s, 1, err)
+	}
+	s = r.redirected(s, redirections)
+	if err := s.SetupRedirection(); err != nil {
+		return r.failed(s, 1, err)
+	}
+	defer s.CloseFiles()
+
+	switch c := command.(type) {
+	case *ast.Group:
+		return r.runList(c.Body, s)
+	case *ast.Subshell:
+		r.Sh.Status = r.runSubshell(c.Body, s)
+		return nil
+	case *ast.IfCmd:
+		return r.runIf(c, s)
+	case *ast.WhileCmd:
+		return r.runWhile(c, s)
+	case *ast.ForCmd:
+		return r.runFor(c, s)
+	case *ast.ArithForCmd:
+		return r.runArithFor(c, s)
+	case *ast.CaseCmd:
+		return r.runCase(c, s)
+	case *ast.CondCmd:
+		return r.runCond(c, s)
+	case *ast.ArithCmd:
+		return r.runArith(c, s)
+	}
+
+	return nil
+}
+
+// redirections expands targets of redirections and bodies of here-documents.
+func (r *Runner) redirections(redirs []*ast.Redirect) ([]cmd.Redirection, error) {
+	result := make([]cmd.Redirection, 0, len(redirs))
+
+	for _, redir := range redirs {
+		target := ""
+		var err error
+
+		switch {
+		case redir.HereDoc != nil && redir.HereDoc.Quoted:
+			target = redir.HereDoc.Body
+		case redir.HereDoc != nil:
+			target, err = r.exp.HereDoc(redir.HereDoc.Body)
+		case redir.Op == "<<<":
+			target, err = r.exp.Literal(redir.Word)
+			target += "\n"
+		default:
+			target, err = r.exp.Literal(redir.Word)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, cmd.Redirection{
+			Fd: redir.Fd,
+			Op: redir.Op,
+			Target: target,
+		})
+	}
+
+	return result, nil
+}
+
+// redirected returns the streams with the redirections,
+// relative filenames are in the working directory of the shell.
+func (r *Runner) redirected(s cmd.Streams, redirections []cmd.Redirection) cmd.Streams {
+	s = s.WithRedirections(redirections)
+	s.Dir = r.Sh.Dir
+	return s
+}
+
+func (r *Runner) runSimple(c *ast.SimpleCmd, s cmd.Streams) error {
+	r.Sh.Lineno = c.Line
+
+	mark := len(r.procSubsts)
+	defer r.endProcSubsts(mark)
+
+	fields, arrays, err := r.fields(c.Words)
+	if err != nil {
+		return r.failed(s, 1, err)
+	}
+
+	redirections, err := r.redirections(c.Redirs.Redirs)
+	if err != nil {
+		return r.failed(s, 1, err)
+	}
+
+	// only assignments and redirections,
+	// the status is of the last command substitution in them
+	if len(fields) == 0 {
+		r.substStatus = -1
+		for _, assign := range c.Assigns {
+			if err := r.assign(r.Sh, assign, s); err != nil {
+				return r.failed(s, 1, err)
+			}
+		}
+
+		s = r.redirected(s, redirections)
+		if err := s.SetupRedirection(); err != nil {
+			return r.failed(s, 1, err)
+		}
+		s.CloseFiles()
+
+		r.Sh.Status = max(r.substStatus, 0)
+		return nil
+	}
+
+	cc := &cmd.CurrentCmd{
+		Cmd: fields[0],
+		Args: fields[1:],
+		Shell: r.Sh,
+		Arrays: arrays,
+		Eval: r.eval,
+		Streams: r.redirected(s, redirections),
+	}
+
+	if err := cc.SetupRedirection(); err != nil {
+		return r.failed(s, 1, err)
+	}
+	defer cc.CloseFiles()
+	r.procSubstFds(cc, mark)
+
+	// assignments before the command are only for this command,
+	// but what builtins and functions do to the shell stays
+	if len(c.Assigns) > 0 {
+		names := make([]string, len(c.Assigns))
+		for i, assign := range c.Assigns {
+			name, _, _, _ := parser.SplitAssign(assign)
+			names[i], _, _ = state.SplitSubscript(name)
+		}
+
+		if cmd.CheckIfFunction(r.Sh, cc.Cmd) || cmd.CheckIfBuiltinCmd(cc.Cmd) {
+			defer r.Sh.Save(names)()
+		} else {
+			cc.Shell = r.Sh.Clone()
+		}
+
+		for i, assign := range c.Assigns {
+			if err := r.assign(cc.Shell, assign, s); err != nil {
+				return r.failed(s, 1, err)
+			}
+			cc.Shell.Export(names[i])
+		}
+	}
+
+	r.trace(s, quoteFields(fields)...)
+	err = r.exec(cc)
+	r.Sh.LastArg = fields[len(fields)-1]
+
+	return r.finish(cc, err)
+}
+
+// declarations are the builtins whose arguments may be assignments
+var declarations = map[string]bool{
+	"declare": true, "typeset": true, "local": true, "export": true, "readonly": true,
+}
+
+// fields expands the words of a simple command. Assignments in the arguments of
+// declaration builtins are not split, the values of name=(...) are returned by the index
+// of the argument.
+func (r *Runner) fields(words []string) ([]string, map[int][]state.Elem, error) {
+	if len(words) == 0 || !declarations[words[0]] || cmd.CheckIfFunction(r.Sh, words[0]) {
+		fields, err := r.exp.Fields(words)
+		return fields, nil, err
+	}
+
+	fields := []string{words[0]}
+	arrays := make(map[int][]state.Elem)
+	for _, word := range words[1:] {
+		name, value, appendTo, ok := parser.SplitAssign(word)
+		if !ok {
+			more, err := r.exp.Fields([]string{word})
+			if err != nil {
+				return nil, nil, err
+			}
+			fields = append(fields, more...)
+			continue
+		}
+
+		op := "="
+		if appendTo {
+			op = "+="
+		}
+		if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+			elems, err := r.compound(value)
+			if err != nil {
+				return nil, nil, err
+			}
+			arrays[len(fields)-1] = elems
+			value = ""
+		} else {
+			var err error
+			if value, err = r.exp.Assignment(value); err != nil {
+				return nil, nil, err
+			}
+		}
+		fields = append(fields, name + op + value)
+	}
+
+	return fields, arrays, nil
+}
+
+// assign runs name=value, name+=value, name[sub]=value and name=(...) in sh.
+func (r *Runner) assign(sh *state.Shell, assign string, s cmd.Streams) error {
+	name, value, appendTo, _ := parser.SplitAssign(assign)
+
+	base, sub, hasSub := state.SplitSubscript(name)
+	if hasSub {
+		sub, err := r.exp.Literal(sub)
+		if err != nil {
+			return err
+		}
+		name = base + "[" + sub + "]"
+	}
+
+	if !hasSub && strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		elems, err := r.compound(value)
+		if err != nil {
+			return err
+		}
+
+		values := make([]string, len(elems))
+		for i, elem := range elems {
+			values[i] = cmd.QuoteValue(elem.Value)
+			if elem.Keyed {
+				values[i] = "[" + elem.Key + "]=" + values[i]
+			}
+		}
+		r.traceAssign(s, name, appendTo, "(" + strings.Join(values, " ") + ")")
+
+		return sh.AssignArray(name, elems, appendTo)
+	}
+
+	value, err := r.exp.Assignment(value)
+	if err != nil {
+		return err
+	}
+	r.traceAssign(s, name, appendTo, cmd.QuoteValue(value))
+
+	if appendTo {
+		return sh.Append(name, value)
+	}
+	return sh.Set(name, value)
+}
+
+// traceAssign prints the assignment with set -x.
+func (r *Runner) traceAssign(s cmd.Streams, name string, appendTo bool, value string) {
+	op := "="
+	if appendTo {
+		op = "+="
+	}
+	r.trace(s, name + op + value)
+}
+
+// trace prints the expanded words of the command after PS4 with set -x.
+func (r *Runner) trace(s cmd.Streams, words ...string) {
+	if !r.Sh.Option("xtrace") {
+		return
+	}
+
+	ps4, ok := r.Sh.Get("PS4")
+	if !ok {
+		ps4 = "+ "
+	}
+	if expanded, err := r.exp.Literal(ps4); err == nil {
+		ps4 = expanded
+	}
+	if ps4 != "" {
+		ps4 = strings.Repeat(ps4[:1], r.traceLevel) + ps4
+	}
+
+	fmt.Fprintln(s.Stderr, ps4 + strings.Join(words, " "))
+}
+
+// quoteFields quotes the fields of a command for the trace of set -x.
+func quoteFields(fields []string) []string {
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = cmd.QuoteValue(field)
+	}
+	return quoted
+}
+
+// compound expands the elements of the array value (...).
+// Elements [key]=value are not split, others are split into fields.
+func (r *Runner) compound(value string) ([]state.Elem, error) {
+	words, err := parser.SplitWords(value[1:len(value)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	elems := []state.Elem{}
+	for _, word := range words {
+		if strings.HasPrefix(word, "[") {
+			if end := strings.Index(word, "]="); end != -1 {
+				key, err := r.exp.Literal(word[1:end])
+				if err != nil {
+					return nil, err
+				}
+				value, err := r.exp.Assignment(word[end+2:])
+				if err != nil {
+					return nil, err
+				}
+				elems = append(elems, state.Elem{Key: key, Keyed: true, Value: value})
+				continue
+			}
+		}
+
+		fields, err := r.exp.Fields([]string{word})
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			elems = append(elems, state.Elem{Value: field})
+		}
+	}
+	return elems, nil
+}
+
+// exec runs a function, a builtin or an external command.
+func (r *Runner) exec(cc *cmd.CurrentCmd) error {
+	if cmd.CheckIfFunction(cc.Shell, cc.Cmd) {
+		return r.callFunction(cc.Shell.Funcs[cc.Cmd], cc)
+	}
+	if cmd.CheckIfBuiltinCmd(cc.Cmd) {
+		return cc.ExecBuiltinCmd()
+	}
+	return cc.ExecOtherCommand()
+}
+
+// eval parses the commands and runs them in the shell.
+// Returns *cmd.StatusError if the last one fails.
+func (r *Runner) eval(src string, s cmd.Streams) error {
+	list, err := parser.ParseAtLine(src, r.Sh.Lineno)
+	if err != nil {
+		r.errorf(s, 2, "%v", err)
+		return &cmd.StatusError{Code: 2}
+	}
+
+	if err := r.runList(list, s); err != nil {
+		return err
+	}
+
+	if r.Sh.Status != 0 {
+		return &cmd.StatusError{Code: r.Sh.Status}
+	}
+	return nil
+}
+
+// finish sets the exit status of the finished command and prints its error.
+// Errors that change the flow of execution are returned.
+func (r *Runner) finish(cc *cmd.CurrentCmd, err error) error {
+	var (
+		breakErr 	*cmd.BreakError
+		continueErr *cmd.ContinueError
+		returnErr 	*cmd.ReturnError
+		exitErr 	*cmd.ExitError
+		abortErr 	*cmd.AbortError
+		statusErr 	*cmd.StatusError
+		execErr 	*exec.ExitError
+	)
+
+	switch {
+	case err == nil:
+		r.Sh.Status = 0
+	case errors.As(err, &breakErr), errors.As(err, &continueErr):
+		if r.loops == 0 {
+			r.errorf(cc.Streams, 0, "%s: only meaningful in a `for', `while', or `until' loop", cc.Cmd)
+			return nil
+		}
+		// break 5 in two loops leaves both of them
+		if breakErr != nil {
+			breakErr.N = min(breakErr.N, r.loops)
+		} else {
+			continueErr.N = min(continueErr.N, r.loops)
+		}
+		r.Sh.Status = 0
+		return err
+	case errors.As(err, &exitErr):
+		r.Sh.Status = exitErr.Code
+		return err
+	case errors.As(err, &returnErr):
+		r.Sh.Status = returnErr.Code
+		return err
+	case errors.As(err, &abortErr):
+		r.Sh.Status = abortErr.Code
+		return err
+	case errors.As(err, &statusErr), errors.As(err, &execErr):
+		r.Sh.Status = cmd.ExitStatus(err)
+	case errors.Is(err, syscall.EPIPE):
+		// a builtin writes to the pipeline whose next command has exited,
+		// a subshell ends with the status of SIGPIPE instead of writing on forever
+		if r.isSubshell {
+			r.Sh.Status = 128 + int(syscall.SIGPIPE)
+			return &cmd.ExitError{Code: r.Sh.Status}
+		}
+		r.Sh.Status = 1
+	default:
+		r.errorf(cc.Streams, cmd.ExitStatus(err), "%v", err)
+	}
+
+	return nil
+}
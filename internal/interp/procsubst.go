@@ -0,0 +1,82 @@
+package interp
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// procSubst is a running process substitution.
+type procSubst struct {
+	file *os.File		// our end of the pipe, /dev/fd/N of the outer command
+	done chan struct{}	// closed when the commands finish
+}
+
+// processSubst starts the commands of <(cmds) or >(cmds) in a subshell
+// and returns the /dev/fd path of the pipe to them.
+func (r *Runner) processSubst(cmds string, output bool) (string, error) {
+	list, err := parser.ParseAtLine(cmds, r.Sh.Lineno)
+	if err != nil {
+		return "", err
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	streams := cmd.Streams{
+		Stdin: os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	file, inner := pr, pw
+	if output {
+		file, inner = pw, pr
+		streams.Stdin = pr
+	} else {
+		streams.Stdout = pw
+	}
+
+	ps := &procSubst{file: file, done: make(chan struct{})}
+	sub := r.subshell()
+	sub.traceLevel++
+	go func() {
+		sub.runList(list, streams)
+		inner.Close()
+		close(ps.done)
+	}()
+	r.procSubsts = append(r.procSubsts, ps)
+
+	return fmt.Sprintf("/dev/fd/%d", file.Fd()), nil
+}
+
+// procSubstFds adds the pipes of the process substitutions started since mark
+// to the descriptors of the command, with the same numbers as in the shell.
+func (r *Runner) procSubstFds(cc *cmd.CurrentCmd, mark int) {
+	if len(r.procSubsts) == mark {
+		return
+	}
+
+	// the map may be shared with the parent
+	fds := make(map[int]*os.File, len(cc.Fds) + len(r.procSubsts) - mark)
+	for fd, f := range cc.Fds {
+		fds[fd] = f
+	}
+	for _, ps := range r.procSubsts[mark:] {
+		fds[int(ps.file.Fd())] = ps.file
+	}
+	cc.Fds = fds
+}
+
+// endProcSubsts closes the pipes of the process substitutions started since mark
+// and waits for their commands.
+func (r *Runner) endProcSubsts(mark int) {
+	for _, ps := range r.procSubsts[mark:] {
+		ps.file.Close()
+		<-ps.done
+	}
+	r.procSubsts = r.procSubsts[:mark]
+}
@@ -0,0 +1,65 @@
+package interp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
+	"github.com/codecrafters-io/shell-starter-go/internal/parser"
+)
+
+// runSubshell runs the commands in a copy of the shell state: the changes of
+// variables, functions and the working directory are lost when it ends.
+// Returns the exit status of the subshell.
+func (r *Runner) runSubshell(list *ast.List, s cmd.Streams) int {
+	sub := r.subshell()
+	err := sub.runList(list, s)
+
+	// exit leaves only the subshell
+	var exitErr *cmd.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return sub.Sh.Status
+}
+
+// substitute runs the commands of a command substitution in a subshell
+// and returns what they write to the standard output.
+func (r *Runner) substitute(cmds string) (string, error) {
+	list, err := parser.ParseAtLine(cmds, r.Sh.Lineno)
+	if err != nil {
+		return "", err
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return "", err
+	}
+
+	output := make(chan string)
+	go func() {
+		buf := strings.Builder{}
+		io.Copy(&buf, pr)
+		pr.Close()
+		output <- buf.String()
+	}()
+
+	streams := cmd.Streams{
+		Stdin: os.Stdin,
+		Stdout: pw,
+		Stderr: os.Stderr,
+	}
+	// set -e is not inherited by command substitutions
+	r.noErrexit++
+	r.traceLevel++
+	r.substStatus = r.runSubshell(list, streams)
+	r.traceLevel--
+	r.noErrexit--
+	r.Sh.Status = r.substStatus
+	pw.Close()
+
+	return <-output, nil
+}
@@ -0,0 +1,475 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+)
+
+// ErrIncomplete means that the input ends in the middle of a command
+// (open quote, missing fi, trailing |, ...) and more lines are needed.
+var ErrIncomplete = errors.New("incomplete input")
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokNewline
+	tokOp					// ; ;; ;& ;;& & && | || |& ( )
+	tokRedirect				// < > >> >| <> <& >& &> &>> << <<- <<<
+)
+
+// the longest first
+var redirectOps = []string{"&>>", "&>", "<<<", "<<-", "<<", "<>", "<&", "<", ">>", ">&", ">|", ">"}
+var controlOps  = []string{";;&", ";;", ";&", ";", "&&", "&", "||", "|&", "|", "(", ")"}
+
+type token struct {
+	kind tokenKind
+	val  string
+	fd   int				// descriptor before a redirection, -1 if none
+	pos  int				// offset in the source
+}
+
+type lexer struct {
+	src 	  string
+	pos 	  int
+	firstLine int				// line number of the start of src
+	heredocs  []*ast.Redirect	// wait for their bodies after the next newline
+}
+
+// lineAt returns the line number of the offset in the source.
+func (l *lexer) lineAt(pos int) int {
+	return l.firstLine + strings.Count(l.src[:pos], "\n")
+}
+
+// next returns the next token.
+func (l *lexer) next() (token, error) {
+	if err := l.skipBlanks(); err != nil {
+		return token{}, err
+	}
+
+	if l.pos >= len(l.src) {
+		if len(l.heredocs) > 0 {
+			return token{}, ErrIncomplete
+		}
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	start := l.pos
+	if l.src[l.pos] == '\n' {
+		l.pos++
+		if err := l.readHereDocs(); err != nil {
+			return token{}, err
+		}
+		return token{kind: tokNewline, val: "\n", pos: start}, nil
+	}
+
+	// <(cmds) and >(cmds) are words
+	if strings.HasPrefix(l.src[l.pos:], "<(") || strings.HasPrefix(l.src[l.pos:], ">(") {
+		l.pos += 2
+		if err := l.subst(); err != nil {
+			return token{}, err
+		}
+		if err := l.word(); err != nil {
+			return token{}, err
+		}
+		return token{kind: tokWord, val: l.src[start:l.pos], fd: -1, pos: start}, nil
+	}
+
+	for _, op := range redirectOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokRedirect, val: op, fd: -1, pos: start}, nil
+		}
+	}
+	for _, op := range controlOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, val: op, pos: start}, nil
+		}
+	}
+
+	if err := l.word(); err != nil {
+		return token{}, err
+	}
+	word := l.src[start:l.pos]
+
+	// the compound value of name=(...) belongs to the word
+	if l.pos < len(l.src) && l.src[l.pos] == '(' && strings.HasSuffix(word, "=") && assignRe.MatchString(word) {
+		if err := l.compound(); err != nil {
+			return token{}, err
+		}
+		return token{kind: tokWord, val: l.src[start:l.pos], fd: -1, pos: start}, nil
+	}
+
+	// 2>file, 10<&0
+	if l.pos < len(l.src) && (l.src[l.pos] == '<' || l.src[l.pos] == '>') && isNumber(word) {
+		tok, err := l.next()
+		if err != nil {
+			return token{}, err
+		}
+		tok.fd = atoi(word)
+		tok.pos = start
+		return tok, nil
+	}
+
+	return token{kind: tokWord, val: word, fd: -1, pos: start}, nil
+}
+
+// skipBlanks skips spaces, line continuations and comments.
+func (l *lexer) skipBlanks() error {
+	for l.pos < len(l.src) {
+		switch ch := l.src[l.pos]; {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			l.pos++
+		case ch == '\\' && l.pos + 1 == len(l.src):
+			return ErrIncomplete
+		case ch == '\\' && l.src[l.pos+1] == '\n':
+			l.pos += 2
+		case ch == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func isMeta(ch byte) bool {
+	switch ch {
+	case ' ', '\t', '\r', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+// word moves pos to the end of the word, skipping over quotes and substitutions.
+func (l *lexer) word() error {
+	for l.pos < len(l.src) && !isMeta(l.src[l.pos]) {
+		if err := l.wordPart(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compound moves pos after the ) of the words of an array value (...).
+func (l *lexer) compound() error {
+	l.pos++
+	for {
+		if err := l.skipBlanks(); err != nil {
+			return err
+		}
+		switch {
+		case l.pos >= len(l.src):
+			return ErrIncomplete
+		case l.src[l.pos] == '\n':
+			l.pos++
+		case l.src[l.pos] == ')':
+			l.pos++
+			return nil
+		case isMeta(l.src[l.pos]):
+			return &SyntaxError{Token: l.src[l.pos:l.pos+1]}
+		default:
+			if err := l.word(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// wordPart reads a character, an escape, a quoted string or a substitution of a word.
+func (l *lexer) wordPart() error {
+	switch l.src[l.pos] {
+	case '\\':
+		if l.pos + 1 >= len(l.src) {
+			return ErrIncomplete
+		}
+		l.pos += 2
+	case '\'':
+		end := strings.IndexByte(l.src[l.pos+1:], '\'')
+		if end == -1 {
+			return ErrIncomplete
+		}
+		l.pos += end + 2
+	case '"':
+		return l.doubleQuoted()
+	case '`':
+		return l.backquoted()
+	case '$':
+		return l.dollar()
+	default:
+		l.pos++
+	}
+	return nil
+}
+
+// regexWord reads the right side of =~ in [[ ]],
+// in which parentheses and | are parts of the word.
+func (l *lexer) regexWord() (token, error) {
+	if err := l.skipBlanks(); err != nil {
+		return token{}, err
+	}
+
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		if depth == 0 && (strings.IndexByte(" \t\n;&", ch) != -1 || ch == ')') {
+			break
+		}
+
+		switch {
+		case ch == '(':
+			depth++
+			l.pos++
+		case ch == ')':
+			depth--
+			l.pos++
+		case isMeta(ch):
+			l.pos++
+		default:
+			if err := l.wordPart(); err != nil {
+				return token{}, err
+			}
+		}
+	}
+
+	if l.pos == start {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	return token{kind: tokWord, val: l.src[start:l.pos], fd: -1, pos: start}, nil
+}
+
+func (l *lexer) doubleQuoted() error {
+	l.pos++
+	for l.pos < len(l.src) {
+		var err error
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '"':
+			l.pos++
+			return nil
+		case '`':
+			err = l.backquoted()
+		case '$':
+			err = l.dollar()
+		default:
+			l.pos++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ErrIncomplete
+}
+
+func (l *lexer) backquoted() error {
+	l.pos++
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '`':
+			l.pos++
+			return nil
+		default:
+			l.pos++
+		}
+	}
+	return ErrIncomplete
+}
+
+// dollar skips $name, ${...}, $(...) and $((...)).
+func (l *lexer) dollar() error {
+	l.pos++
+	if l.pos >= len(l.src) {
+		return nil
+	}
+
+	switch l.src[l.pos] {
+	case '{':
+		return l.braced()
+	case '(':
+		if strings.HasPrefix(l.src[l.pos:], "((") {
+			l.pos += 2
+			_, err := l.arith()
+			return err
+		}
+		l.pos++
+		return l.subst()
+	}
+	return nil
+}
+
+// braced skips ${...} up to the matching brace.
+func (l *lexer) braced() error {
+	l.pos++
+	for l.pos < len(l.src) {
+		var err error
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos += 2
+		case '}':
+			l.pos++
+			return nil
+		case '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end == -1 {
+				return ErrIncomplete
+			}
+			l.pos += end + 2
+		case '"':
+			err = l.doubleQuoted()
+		case '`':
+			err = l.backquoted()
+		case '$':
+			err = l.dollar()
+		default:
+			l.pos++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ErrIncomplete
+}
+
+// subst skips the commands of $( ... ) by parsing them, pos is right after "(".
+func (l *lexer) subst() error {
+	p := &parser{lex: &lexer{src: l.src, pos: l.pos, firstLine: l.firstLine}}
+	if err := p.next(); err != nil {
+		return err
+	}
+	if _, err := p.parseList(")"); err != nil {
+		return err
+	}
+	if !p.isOp(")") {
+		return p.unexpected()
+	}
+
+	l.pos = p.tok.pos + 1
+	return nil
+}
+
+// arith returns the expression up to the matching "))", pos is right after "((".
+func (l *lexer) arith() (string, error) {
+	start := l.pos
+	depth := 0
+	for l.pos < len(l.src) {
+		switch l.src[l.pos] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				if !strings.HasPrefix(l.src[l.pos:], "))") {
+					return "", &SyntaxError{Token: ")"}
+				}
+				expr := l.src[start:l.pos]
+				l.pos += 2
+				return expr, nil
+			}
+			depth--
+		case '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end == -1 {
+				return "", ErrIncomplete
+			}
+			l.pos += end + 1
+		case '"':
+			if err := l.doubleQuoted(); err != nil {
+				return "", err
+			}
+			continue
+		case '$':
+			if err := l.dollar(); err != nil {
+				return "", err
+			}
+			continue
+		}
+		l.pos++
+	}
+	return "", ErrIncomplete
+}
+
+// readHereDocs reads bodies of the here-documents started on the line that just ended.
+func (l *lexer) readHereDocs() error {
+	for len(l.heredocs) > 0 {
+		redir := l.heredocs[0]
+		body := strings.Builder{}
+		for {
+			if l.pos >= len(l.src) {
+				return ErrIncomplete
+			}
+
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			var line string
+			if end == -1 {
+				line = l.src[l.pos:]
+				l.pos = len(l.src)
+			} else {
+				line = l.src[l.pos:l.pos+end]
+				l.pos += end + 1
+			}
+
+			if redir.Op == "<<-" {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == redir.Word {
+				break
+			}
+			body.WriteString(line + "\n")
+		}
+
+		redir.HereDoc.Body = body.String()
+		l.heredocs = l.heredocs[1:]
+	}
+	return nil
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func atoi(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = n*10 + int(s[i]-'0')
+	}
+	return n
+}
+
+// SubstEnd returns the index right after the substitution or parameter expansion
+// that starts at src[start] with "$", "`", "<(" or ">(".
+func SubstEnd(src string, start int) (int, error) {
+	l := &lexer{src: src, pos: start}
+
+	var err error
+	switch src[start] {
+	case '`':
+		err = l.backquoted()
+	case '<', '>':
+		l.pos += 2
+		err = l.subst()
+	default:
+		err = l.dollar()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return l.pos, nil
+}
@@ -2,162 +2,904 @@ package parser
 
 import (
 	"fmt"
-	"os"
+	"regexp"
 	"strings"
 
-	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
-	"github.com/codecrafters-io/shell-starter-go/internal/pipeline"
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
 )
 
-type state int
+// SyntaxError is returned for input that can't be parsed.
+type SyntaxError struct {
+	Token string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error near unexpected token `%s'", e.Token)
+}
+
+var keywords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"while": true, "until": true, "for": true, "in": true, "do": true, "done": true,
+	"case": true, "esac": true, "!": true, "{": true, "}": true, "function": true,
+	"[[": true, "]]": true,
+}
 
-const (
-	stateOutside state = iota
-	stateSingleQuote			// '' don't work \
-	stateDoubleQuote			// "" \ work for \ " ($ ` not implemented)
+// IsKeyword reports whether word is a reserved word of the shell.
+func IsKeyword(word string) bool {
+	return keywords[word]
+}
+
+var (
+	nameRe 	  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	assignRe  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*(\[[^\]]*\])?)(\+?)=`)
+	funcParRe = regexp.MustCompile(`^[ \t]*\([ \t]*\)`)
 )
 
+// IsName reports whether s can be a variable name.
+func IsName(s string) bool {
+	return nameRe.MatchString(s)
+}
+
+// SplitAssign splits the assignment name=value or name+=value, the name may have a [subscript].
+func SplitAssign(word string) (name, value string, appendTo, ok bool) {
+	m := assignRe.FindStringSubmatch(word)
+	if m == nil {
+		return "", "", false, false
+	}
+	return m[1], word[len(m[0]):], m[3] == "+", true
+}
+
+// SplitWords splits the contents of a compound array value (...) into its words.
+func SplitWords(src string) ([]string, error) {
+	lex := &lexer{src: src}
+	words := []string{}
+	for {
+		tok, err := lex.next()
+		switch {
+		case err != nil:
+			return nil, err
+		case tok.kind == tokEOF:
+			return words, nil
+		case tok.kind == tokWord:
+			words = append(words, tok.val)
+		case tok.kind != tokNewline:
+			return nil, &SyntaxError{Token: tok.val}
+		}
+	}
+}
+
 type parser struct {
-    args    	  [][]string
-    current 	  strings.Builder
-	backslashSeen bool
-	state   	  state
-}
-
-// ParseInput is the main parser, divides into pipe and argument, taking into account the state.
-func ParseInput(input string) ([][]string, error) {
-	if input == "" {
-		return nil, fmt.Errorf("empty input")
-	}
-
-	prsr := parser{
-		args: make([][]string, 1),
-		current: strings.Builder{},
-		backslashSeen: false,
-		state: stateOutside,
-	}
-
-	indexCmd := 0
-	for _, ch := range input {
-		switch prsr.state {
-		case stateOutside:
-			if prsr.backslashSeen {
-				prsr.current.WriteRune(ch)
-				prsr.backslashSeen = false
-			} else if ch == '\\' {
-				prsr.backslashSeen = true
-			} else if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '|' { // arg or pipe is over
-				if prsr.current.Len() > 0 {
-					// for safe access by index
-					if indexCmd >= len(prsr.args) {
-						for i := len(prsr.args); i <= indexCmd; i++ {
-							prsr.args = append(prsr.args, []string{})
-						}
-					}
-					prsr.args[indexCmd] = append(prsr.args[indexCmd], prsr.current.String())
-					prsr.current.Reset()
-				}
-
-				if ch == '|' {
-					indexCmd++
-				}
-
-			} else if ch == '\'' {
-				prsr.state = stateSingleQuote
-			} else if ch == '"' {
-				prsr.state = stateDoubleQuote
-			} else if ch != '\\' { // handle separately
-				prsr.current.WriteRune(ch)
-			}
-
-		case stateSingleQuote:
-			if ch == '\''{
-				prsr.state = stateOutside
-			} else {
-				prsr.current.WriteRune(ch)
-			}
-		case stateDoubleQuote:
-			if prsr.backslashSeen {
-				if ch == '\\' || ch == '"' { // $, `
-					prsr.current.WriteRune(ch)
-				} else {
-					prsr.current.WriteRune('\\')
-					prsr.current.WriteRune(ch)
-				}
-				prsr.backslashSeen = false
+	lex *lexer
+	tok token				// current token
+}
+
+// Parse parses the input into a list of commands.
+// Returns ErrIncomplete if the input ends in the middle of a command,
+// then the caller may read more lines and try again.
+func Parse(input string) (*ast.List, error) {
+	return ParseAtLine(input, 1)
+}
+
+// ParseAtLine is Parse for input that starts at firstLine of a script.
+func ParseAtLine(input string, firstLine int) (*ast.List, error) {
+	p := &parser{lex: &lexer{src: input, firstLine: firstLine}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+
+	return list, nil
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.val == op
+}
+
+func (p *parser) isWord(word string) bool {
+	return p.tok.kind == tokWord && p.tok.val == word
+}
+
+// unexpected returns the error for the current token.
+// The end of input in the middle of a command is not an error, just incomplete input.
+func (p *parser) unexpected() error {
+	switch p.tok.kind {
+	case tokEOF:
+		return ErrIncomplete
+	case tokNewline:
+		return &SyntaxError{Token: "newline"}
+	}
+	return &SyntaxError{Token: p.tok.val}
+}
+
+// expect consumes the keyword or operator s.
+func (p *parser) expect(s string) error {
+	if (p.tok.kind != tokWord && p.tok.kind != tokOp) || p.tok.val != s {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+func (p *parser) skipNewlines() error {
+	for p.tok.kind == tokNewline {
+		if err := p.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atStop reports whether the current token ends a list.
+func (p *parser) atStop(stops []string) bool {
+	if p.tok.kind == tokEOF {
+		return true
+	}
+	if p.tok.kind != tokWord && p.tok.kind != tokOp {
+		return false
+	}
+	for _, stop := range stops {
+		if p.tok.val == stop {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList parses and-or lists until one of stops (keywords or operators) or the end of input.
+func (p *parser) parseList(stops ...string) (*ast.List, error) {
+	list := &ast.List{}
+
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	for !p.atStop(stops) {
+		andOr, err := p.parseAndOr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, andOr)
+
+		switch {
+		case p.isOp("&"):
+			andOr.Background = true
+			fallthrough
+		case p.isOp(";") || p.tok.kind == tokNewline:
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if err := p.skipNewlines(); err != nil {
+				return nil, err
+			}
+		case !p.atStop(stops):
+			return nil, p.unexpected()
+		}
+	}
+
+	// the list has to be closed by one of stops
+	if len(stops) > 0 && p.tok.kind == tokEOF {
+		return nil, ErrIncomplete
+	}
+
+	return list, nil
+}
+
+func (p *parser) parseAndOr() (*ast.AndOr, error) {
+	andOr := &ast.AndOr{}
+
+	for {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return nil, err
+		}
+		andOr.Pipelines = append(andOr.Pipelines, pipeline)
+
+		if !p.isOp("&&") && !p.isOp("||") {
+			return andOr, nil
+		}
+		andOr.Ops = append(andOr.Ops, p.tok.val)
+
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parsePipeline() (*ast.Pipeline, error) {
+	pipeline := &ast.Pipeline{}
+
+	if p.isWord("!") {
+		pipeline.Negate = true
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		command, err := p.parseCommand()
+		if err != nil {
+			return nil, err
+		}
+		pipeline.Cmds = append(pipeline.Cmds, command)
+
+		if !p.isOp("|") && !p.isOp("|&") {
+			return pipeline, nil
+		}
+
+		// cmd1 |& cmd2 is short for cmd1 2>&1 | cmd2
+		if p.isOp("|&") {
+			command.AddRedirect(&ast.Redirect{Fd: 2, Op: ">&", Word: "1"})
+		}
+
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseCommand() (ast.Command, error) {
+	var command ast.Command
+	var err error
+
+	if p.tok.kind == tokWord {
+		switch p.tok.val {
+		case "if":
+			command, err = p.parseIf()
+		case "while", "until":
+			command, err = p.parseWhile()
+		case "for":
+			command, err = p.parseFor()
+		case "case":
+			command, err = p.parseCase()
+		case "{":
+			command, err = p.parseGroup()
+		case "function":
+			return p.parseFunction()
+		case "[[":
+			command, err = p.parseCond()
+		case "then", "elif", "else", "fi", "do", "done", "esac", "}", "]]":
+			return nil, p.unexpected()
+		default:
+			if IsName(p.tok.val) && funcParRe.MatchString(p.lex.src[p.lex.pos:]) {
+				return p.parseFunction()
+			}
+			return p.parseSimple()
+		}
+	} else if p.atArith() {
+		command, err = p.parseArith()
+	} else if p.isOp("(") {
+		command, err = p.parseSubshell()
+	} else {
+		return p.parseSimple()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// redirections after compound command
+	for p.tok.kind == tokRedirect {
+		redir, err := p.parseRedirect()
+		if err != nil {
+			return nil, err
+		}
+		command.AddRedirect(redir)
+	}
+
+	return command, nil
+}
+
+func (p *parser) parseSimple() (*ast.SimpleCmd, error) {
+	simple := &ast.SimpleCmd{Line: p.lex.lineAt(p.tok.pos)}
+
+	for {
+		switch {
+		case p.tok.kind == tokWord:
+			if len(simple.Words) == 0 && assignRe.MatchString(p.tok.val) {
+				simple.Assigns = append(simple.Assigns, p.tok.val)
 			} else {
-				if ch == '\\' {
-					prsr.backslashSeen = true
-				} else if ch == '"' {
-					prsr.state = stateOutside
-				} else {
-					prsr.current.WriteRune(ch)
-				}
+				simple.Words = append(simple.Words, p.tok.val)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		case p.tok.kind == tokRedirect:
+			redir, err := p.parseRedirect()
+			if err != nil {
+				return nil, err
+			}
+			simple.AddRedirect(redir)
+		default:
+			if len(simple.Words) == 0 && len(simple.Assigns) == 0 && len(simple.Redirs.Redirs) == 0 {
+				return nil, p.unexpected()
+			}
+			return simple, nil
+		}
+	}
+}
+
+func (p *parser) parseRedirect() (*ast.Redirect, error) {
+	redir := &ast.Redirect{
+		Fd: p.tok.fd,
+		Op: p.tok.val,
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokWord {
+		return nil, p.unexpected()
+	}
+	redir.Word = p.tok.val
+
+	// the body is read by the lexer after the end of the line
+	if redir.Op == "<<" || redir.Op == "<<-" {
+		redir.HereDoc = &ast.HereDoc{
+			Quoted: strings.ContainsAny(redir.Word, "'\"\\"),
+		}
+		redir.Word = unquote(redir.Word)
+		p.lex.heredocs = append(p.lex.heredocs, redir)
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return redir, nil
+}
+
+// unquote removes quotes from a here-document delimiter.
+func unquote(word string) string {
+	buf := strings.Builder{}
+	quote := byte(0)
+	for i := 0; i < len(word); i++ {
+		ch := word[i]
+		switch {
+		case quote != 0 && ch == quote:
+			quote = 0
+		case quote == 0 && (ch == '\'' || ch == '"'):
+			quote = ch
+		case quote != '\'' && ch == '\\' && i + 1 < len(word):
+			i++
+			buf.WriteByte(word[i])
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+	return buf.String()
+}
+
+func (p *parser) parseIf() (*ast.IfCmd, error) {
+	ifCmd := &ast.IfCmd{}
+
+	for p.isWord("if") || p.isWord("elif") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		cond, err := p.parseList("then")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		then, err := p.parseList("elif", "else", "fi")
+		if err != nil {
+			return nil, err
+		}
+		ifCmd.Conds = append(ifCmd.Conds, cond)
+		ifCmd.Thens = append(ifCmd.Thens, then)
+	}
+
+	if p.isWord("else") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		elseList, err := p.parseList("fi")
+		if err != nil {
+			return nil, err
+		}
+		ifCmd.Else = elseList
+	}
+
+	if err := p.expect("fi"); err != nil {
+		return nil, err
+	}
+	return ifCmd, nil
+}
+
+func (p *parser) parseWhile() (*ast.WhileCmd, error) {
+	whileCmd := &ast.WhileCmd{Until: p.isWord("until")}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseList("do")
+	if err != nil {
+		return nil, err
+	}
+	whileCmd.Cond = cond
+
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	whileCmd.Body = body
+
+	return whileCmd, nil
+}
+
+// parseDoGroup parses do list done.
+func (p *parser) parseDoGroup() (*ast.List, error) {
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.parseList("done")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("done"); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// atArith reports whether the current "(" token starts "((".
+func (p *parser) atArith() bool {
+	return p.isOp("(") && strings.HasPrefix(p.lex.src[p.tok.pos:], "((")
+}
+
+func (p *parser) parseFor() (ast.Command, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if p.atArith() {
+		return p.parseArithFor()
+	}
+
+	if p.tok.kind != tokWord || !IsName(p.tok.val) {
+		return nil, p.unexpected()
+	}
+	forCmd := &ast.ForCmd{Var: p.tok.val}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	if p.isWord("in") {
+		forCmd.HasIn = true
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for p.tok.kind == tokWord {
+			forCmd.Words = append(forCmd.Words, p.tok.val)
+			if err := p.next(); err != nil {
+				return nil, err
 			}
 		}
+		if !p.isOp(";") && p.tok.kind != tokNewline {
+			return nil, p.unexpected()
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	} else if p.isOp(";") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	forCmd.Body = body
+
+	return forCmd, nil
+}
+
+// parseArith parses (( expression )), the current token is "(".
+func (p *parser) parseArith() (*ast.ArithCmd, error) {
+	p.lex.pos = p.tok.pos + 2
+	expr, err := p.lex.arith()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return &ast.ArithCmd{Expr: expr}, nil
+}
+
+// parseArithFor parses for ((init; cond; post)); do list done, the current token is "(".
+func (p *parser) parseArithFor() (*ast.ArithForCmd, error) {
+	p.lex.pos = p.tok.pos + 2
+	expr, err := p.lex.arith()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(expr, ";")
+	if len(parts) != 3 {
+		return nil, &SyntaxError{Token: "(("}
+	}
+	forCmd := &ast.ArithForCmd{
+		Init: strings.TrimSpace(parts[0]),
+		Cond: strings.TrimSpace(parts[1]),
+		Post: strings.TrimSpace(parts[2]),
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.isOp(";") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseDoGroup()
+	if err != nil {
+		return nil, err
+	}
+	forCmd.Body = body
+
+	return forCmd, nil
+}
+
+func (p *parser) parseCase() (*ast.CaseCmd, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokWord {
+		return nil, p.unexpected()
+	}
+	caseCmd := &ast.CaseCmd{Word: p.tok.val}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
 	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	for !p.isWord("esac") {
+		item := &ast.CaseItem{Term: ";;"}
+
+		if p.isOp("(") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		for {
+			if p.tok.kind != tokWord {
+				return nil, p.unexpected()
+			}
+			item.Patterns = append(item.Patterns, p.tok.val)
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if !p.isOp("|") {
+				break
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		body, err := p.parseList(";;", ";&", ";;&", "esac")
+		if err != nil {
+			return nil, err
+		}
+		item.Body = body
+		caseCmd.Items = append(caseCmd.Items, item)
 
-	if prsr.current.Len() > 0 {
-		// for safe access by index
-		if indexCmd >= len(prsr.args) {
-			for i := len(prsr.args); i <= indexCmd; i++ {
-				prsr.args = append(prsr.args, []string{})
+		if p.isOp(";;") || p.isOp(";&") || p.isOp(";;&") {
+			item.Term = p.tok.val
+			if err := p.next(); err != nil {
+				return nil, err
 			}
+			if err := p.skipNewlines(); err != nil {
+				return nil, err
+			}
+		} else if !p.isWord("esac") {
+			return nil, p.unexpected()
+		}
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return caseCmd, nil
+}
+
+func (p *parser) parseGroup() (*ast.Group, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	body, err := p.parseList("}")
+	if err != nil {
+		return nil, err
+	}
+	if len(body.Items) == 0 {
+		return nil, p.unexpected()
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	return &ast.Group{Body: body}, nil
+}
+
+func (p *parser) parseSubshell() (*ast.Subshell, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	body, err := p.parseList(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(body.Items) == 0 {
+		return nil, p.unexpected()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &ast.Subshell{Body: body}, nil
+}
+
+// parseFunction parses name() body or function name [()] body.
+func (p *parser) parseFunction() (*ast.FuncDecl, error) {
+	start := p.tok.pos
+
+	if p.isWord("function") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokWord {
+			return nil, p.unexpected()
+		}
+	}
+	fn := &ast.FuncDecl{Name: p.tok.val}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.isOp("(") {
+		if err := p.next(); err != nil {
+			return nil, err
 		}
-		prsr.args[indexCmd] = append(prsr.args[indexCmd], prsr.current.String())
-		prsr.current.Reset()
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	// the body is a compound command
+	if !(p.tok.kind == tokWord && IsKeyword(p.tok.val)) && !p.isOp("(") {
+		return nil, p.unexpected()
+	}
+	body, err := p.parseCommand()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := body.(*ast.SimpleCmd); ok {
+		return nil, &SyntaxError{Token: fn.Name}
+	}
+	fn.Body = body
+
+	end := p.tok.pos
+	if p.tok.kind == tokEOF {
+		end = len(p.lex.src)
+	}
+	fn.Src = strings.TrimRight(p.lex.src[start:end], " \t\n;&|")
+
+	return fn, nil
+}
+
+// unary and binary operators of [[ ]] and test
+var (
+	condUnary = map[string]bool{
+		"-a": true, "-b": true, "-c": true, "-d": true, "-e": true, "-f": true, "-g": true,
+		"-h": true, "-k": true, "-p": true, "-r": true, "-s": true, "-t": true, "-u": true,
+		"-w": true, "-x": true, "-G": true, "-L": true, "-N": true, "-O": true, "-S": true,
+		"-z": true, "-n": true, "-o": true, "-v": true,
+	}
+	condBinary = map[string]bool{
+		"=": true, "==": true, "!=": true, "<": true, ">": true, "=~": true,
+		"-eq": true, "-ne": true, "-lt": true, "-le": true, "-gt": true, "-ge": true,
+		"-nt": true, "-ot": true, "-ef": true,
+	}
+)
+
+// IsUnaryTest reports whether op is a unary operator of test.
+func IsUnaryTest(op string) bool {
+	return condUnary[op]
+}
+
+// IsBinaryTest reports whether op is a binary operator of test.
+func IsBinaryTest(op string) bool {
+	return condBinary[op] && op != "=~"
+}
+
+// parseCond parses [[ expression ]], the words inside are not split and
+// < > are comparisons, not redirections.
+func (p *parser) parseCond() (*ast.CondCmd, error) {
+	if err := p.next(); err != nil {
+		return nil, err
 	}
 
+	expr, err := p.condOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("]]"); err != nil {
+		return nil, err
+	}
+
+	return &ast.CondCmd{Expr: expr}, nil
+}
 
-	return prsr.args, nil
+// condWord returns the current token as a word of [[ ]].
+func (p *parser) condWord() (string, bool) {
+	switch {
+	case p.tok.kind == tokWord && p.tok.val != "]]":
+		return p.tok.val, true
+	case p.tok.kind == tokRedirect && (p.tok.val == "<" || p.tok.val == ">") && p.tok.fd == -1:
+		return p.tok.val, true
+	}
+	return "", false
 }
 
-// HandleInputToCmds completes processing after ParseInput in to struct Cmds.
-func HandleInputToCmds(inputCmdsSlice [][]string) *pipeline.Cmds {
-	c := pipeline.Cmds{
-		Cmds: make([]*cmd.CurrentCmd, 0, 2),
+func (p *parser) condOr() (*ast.CondExpr, error) {
+	x, err := p.condAnd()
+	for err == nil && p.isOp("||") {
+		if err = p.next(); err != nil {
+			break
+		}
+		if err = p.skipNewlines(); err != nil {
+			break
+		}
+		var y *ast.CondExpr
+		y, err = p.condAnd()
+		x = &ast.CondExpr{Op: "||", X: x, Y: y}
 	}
+	return x, err
+}
 
-	for _, cmd := range inputCmdsSlice {
-		c.Cmds = append(c.Cmds, handleInputToOneCmd(cmd))
-		c.CountCmd++
+func (p *parser) condAnd() (*ast.CondExpr, error) {
+	x, err := p.condNot()
+	for err == nil && p.isOp("&&") {
+		if err = p.next(); err != nil {
+			break
+		}
+		if err = p.skipNewlines(); err != nil {
+			break
+		}
+		var y *ast.CondExpr
+		y, err = p.condNot()
+		x = &ast.CondExpr{Op: "&&", X: x, Y: y}
 	}
+	return x, err
+}
 
-	return &c
+func (p *parser) condNot() (*ast.CondExpr, error) {
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	if p.isWord("!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.condNot()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.CondExpr{Op: "!", X: x}, nil
+	}
+	return p.condPrimary()
 }
 
-// handleInputToOneCmd create CurrentCmd, fills in the fields if there were redirects.
-func handleInputToOneCmd(inputSlice []string) *cmd.CurrentCmd {
-	curCmd := cmd.CurrentCmd{
-		Cmd: inputSlice[0],
-		Args:  make([]string, 0, 4),
-		Stderr: os.Stderr,
-		Stdout: os.Stdout,
-		Stdin: os.Stdin,
-		Redirect: cmd.Redirect{
-			Files: make([]string, 0, 2),
-		},
+func (p *parser) condPrimary() (*ast.CondExpr, error) {
+	if p.isOp("(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.condOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &ast.CondExpr{Op: "(", X: x}, nil
 	}
 
-	needWrite := false
-	for i := 1; i < len(inputSlice); i++ {
-		if needWrite {
-			curCmd.Files = append(curCmd.Files, inputSlice[i])
-			needWrite = false
-		} else if inputSlice[i] == ">" || inputSlice[i] == "1>" || inputSlice[i] == "2>" {
-			// can be rewritten if file exist
-			needWrite = true
-			curCmd.RedirectType = inputSlice[i]
-			curCmd.Flag = os.O_CREATE | os.O_RDWR
-		} else if inputSlice[i] == ">>" || inputSlice[i] == "1>>" || inputSlice[i] == "2>>" {
-			// needs to be added to the end of the file f file exist
-			needWrite = true
-			curCmd.RedirectType = inputSlice[i]
-			curCmd.Flag = os.O_CREATE | os.O_RDWR | os.O_APPEND
-		} else {
-			curCmd.Args = append(curCmd.Args, inputSlice[i])
+	first, ok := p.condWord()
+	if !ok {
+		return nil, p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	// unary test
+	if condUnary[first] {
+		if arg, ok := p.condWord(); ok {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			return &ast.CondExpr{Op: first, Words: []string{arg}}, nil
 		}
 	}
 
-	return &curCmd
-}
\ No newline at end of file
+	op, ok := p.condWord()
+	if !ok {
+		return &ast.CondExpr{Words: []string{first}}, nil
+	}
+	if !condBinary[op] {
+		return nil, &SyntaxError{Token: op}
+	}
+
+	var second token
+	var err error
+	if op == "=~" {
+		second, err = p.lex.regexWord()
+	} else {
+		second, err = p.lex.next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.tok = second
+	arg, ok := p.condWord()
+	if !ok {
+		return nil, p.unexpected()
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	return &ast.CondExpr{Op: op, Words: []string{first, arg}}, nil
+}
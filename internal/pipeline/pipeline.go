@@ -1,20 +1,21 @@
 package pipeline
 
 import (
-	"context"
-	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"strings"
 	"sync"
-
-	"github.com/codecrafters-io/shell-starter-go/internal/cmd"
 )
 
+// Stage runs one command of the pipeline with its ends of the pipes, returns the exit status.
+type Stage func(stdin io.Reader, stdout io.Writer) int
+
 type Cmds struct {
-	Cmds	 	[]*cmd.CurrentCmd
+	Stages	 	[]Stage
 	CountCmd 	int
+	Stdin 		io.Reader	// stdin of the first command
+	Stdout 		io.Writer	// stdout of the last command
+	Stderr 		io.Writer
 	Wg 		 	sync.WaitGroup
 }
 
@@ -28,8 +29,8 @@ func (c *Cmds) CreatePipeline() (readers []*os.File, writers []*os.File, err err
 			// close that already open
 			if i > 0 {
 				for j := i - 1; j >= 0; j-- {
-					if readers[j] != nil {
-						readers[j].Close()
+					if readers[j+1] != nil {
+						readers[j+1].Close()
 					}
 					if writers[j] != nil {
 						writers[j].Close()
@@ -46,70 +47,36 @@ func (c *Cmds) CreatePipeline() (readers []*os.File, writers []*os.File, err err
 	return readers, writers, nil
 }
 
-func(c *Cmds) SetupCmdPipe(i int, readers, writers []*os.File, devNull *os.File) {
-	// if readers == nil || writers == nil || devNull == nil  || i < 0 {
-	// 	return fmt.Errorf("received incorrect data")
-	// }
-
-	curCmd := c.Cmds[i]
-
-	if readers[i] != nil {
-		curCmd.Stdin = readers[i]
-	}
-
-	if curCmd.RedirectType == ">" || curCmd.RedirectType == ">>" || curCmd.RedirectType == "1>" || curCmd.RedirectType == "1>>" {
-		// if redirect, writers don't need.
-		writers[i].Close()
-	} else if i < c.CountCmd - 1 {
-		nextCmd := c.Cmds[i+1]
-		if cmd.CheckIfBuiltinCmd(nextCmd.Cmd) {
-			// builtins cmd don't read -> write in dev/null
-			curCmd.Stdout = devNull
-			writers[i].Close()
-		} else {
-			curCmd.Stdout = writers[i]
-		}
-	} else {
-		// last cmd writes in stdout
-		curCmd.Stdout = os.Stdout
-	}
-}
-
-func (c *Cmds) ExecPipeline() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to open devnull: %v\n", err)
-		return
-	}
-	defer devNull.Close()
+// ExecPipeline runs all commands concurrently, returns exit statuses of all commands.
+func (c *Cmds) ExecPipeline() []int {
+	statuses := make([]int, c.CountCmd)
 
 	readers, writers, err := c.CreatePipeline()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create pipeline: %v\n", err)
-        return
-	}
-
-	for i := range c.Cmds {
-		c.SetupCmdPipe(i, readers, writers, devNull)
-	}
-
-	type errorCmd struct {
-		i   int
-		err error
+		fmt.Fprintf(c.Stderr, "failed to create pipeline: %v\n", err)
+		for i := range statuses {
+			statuses[i] = 1
+		}
+		return statuses
 	}
 
- 	errCh := make(chan errorCmd, c.CountCmd)
-
-	for i := range c.Cmds {
+	for i := range c.Stages {
 		i := i
 		c.Wg.Add(1)
 
+		var stdin io.Reader = c.Stdin
+		if readers[i] != nil {
+			stdin = readers[i]
+		}
+		var stdout io.Writer = c.Stdout
+		if writers[i] != nil {
+			stdout = writers[i]
+		}
+
 		go func() {
 			defer c.Wg.Done()
 
+			// the next command gets EOF, the previous one gets broken pipe
 			defer func() {
 				if readers[i] != nil {
 					readers[i].Close()
@@ -119,39 +86,11 @@ func (c *Cmds) ExecPipeline() {
 				}
 			}()
 
-			select {
-			case <- ctx.Done():
-				return
-			default:
-			}
-
-			err := c.Cmds[i].Run()
-			if err != nil {
-				if strings.Contains(err.Error(), "broken pipe") {
-					if cmd.CheckIfBuiltinCmd(c.Cmds[i].Cmd) {
-						return
-					}
-				}
-
-				select {
-				case errCh <- errorCmd{i: i, err: err}:
-					cancel()
-				default:
-				}
-			}
+			statuses[i] = c.Stages[i](stdin, stdout)
 		}()
 	}
 
-	go func() {
-		c.Wg.Wait()
-		close(errCh)
-	}()
+	c.Wg.Wait()
 
-	// ignore ExitError (exit status ...)
-	for err := range errCh {
-		var exitErr *exec.ExitError
-		if !errors.As(err.err, &exitErr) {
-			fmt.Fprintf(c.Cmds[err.i].Stderr, "%v\n", err.err)
-		}
-	}
-}
\ No newline at end of file
+	return statuses
+}
@@ -0,0 +1,20 @@
+package state
+
+import "sync/atomic"
+
+// Job is a list of commands running in the background.
+type Job struct {
+	Pid 	int		// $!, fixed when the job is created
+}
+
+// lastPid numbers the jobs. They run in the shell process and have no process of their own,
+// their ids start above the largest pid of Linux so that they are not taken for one.
+var lastPid atomic.Int64
+
+func init() {
+	lastPid.Store(1 << 22)
+}
+
+func NewJob() *Job {
+	return &Job{Pid: int(lastPid.Add(1))}
+}
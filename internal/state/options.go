@@ -0,0 +1,65 @@
+package state
+
+import "fmt"
+
+// Option is an option of the shell, set with set -o name or with its letter.
+type Option struct {
+	Name string
+	Flag byte					// letter of set -x, 0 if there is only the name
+}
+
+// Options are the options of set -o in the order they are listed.
+var Options = []Option{
+	{"errexit", 'e'},			// exit when a command fails
+	{"histexpand", 'H'},		// ! expands lines of the history, on in interactive shells
+	{"histnodups", 0},			// Up and Down skip records that are the same as the line shown
+	{"histprefix", 0},			// Up and Down visit only records that start with the text before the cursor
+	{"histshare", 0},			// the history file gets each command at once and the commands of other shells are read from it
+	{"noglob", 'f'},			// no pathname expansion
+	{"nounset", 'u'},			// expanding an unset variable is an error
+	{"pipefail", 0},			// the status of a pipeline is of its last failed command
+	{"verbose", 'v'},			// print the input lines as they are read
+	{"xtrace", 'x'},			// print the commands before running them
+}
+
+// the letters of $- in the order the shell prints them
+const flagOrder = "efiuvxH"
+
+// OptionByFlag returns the name of the option with the letter.
+func OptionByFlag(flag byte) (string, bool) {
+	for _, opt := range Options {
+		if opt.Flag == flag && flag != 0 {
+			return opt.Name, true
+		}
+	}
+	return "", false
+}
+
+// Option reports whether the option is on.
+func (sh *Shell) Option(name string) bool {
+	return sh.Opts[name]
+}
+
+// SetOption turns the option on or off.
+func (sh *Shell) SetOption(name string, on bool) error {
+	for _, opt := range Options {
+		if opt.Name == name {
+			sh.Opts[name] = on
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: invalid option name", name)
+}
+
+// Flags returns the letters of the options of the shell ($-).
+func (sh *Shell) Flags() string {
+	flags := ""
+	for i := 0; i < len(flagOrder); i++ {
+		flag := flagOrder[i]
+		name, _ := OptionByFlag(flag)
+		if flag == 'i' && sh.Interactive || sh.Option(name) {
+			flags += string(flag)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,126 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+)
+
+// Frame is a call of a function.
+type Frame struct {
+	Func 	 string
+	CallLine int				// line of the command that called the function
+	Source 	 string				// script of the command that called the function
+	saved 	 map[string]*Var	// variables hidden by local ones, nil if they were unset
+}
+
+// Call starts the function: saves the positional parameters and pushes a frame
+// for its local variables. The returned func ends the call.
+func (sh *Shell) Call(name string, args []string) (end func()) {
+	params := sh.Params
+	sh.Params = args
+	sh.Frames = append(sh.Frames, &Frame{
+		Func: name,
+		CallLine: sh.Lineno,
+		Source: sh.Name,
+		saved: make(map[string]*Var),
+	})
+
+	return func() {
+		frame := sh.Frames[len(sh.Frames)-1]
+		sh.Frames = sh.Frames[:len(sh.Frames)-1]
+		sh.Params = params
+
+		for name, v := range frame.saved {
+			if v == nil {
+				delete(sh.Vars, name)
+			} else {
+				sh.Vars[name] = v
+			}
+		}
+	}
+}
+
+// InFunction reports whether a function is running.
+func (sh *Shell) InFunction() bool {
+	return len(sh.Frames) > 0
+}
+
+// Local makes the variable local to the running function, declared but not set,
+// the old value comes back when the function returns.
+func (sh *Shell) Local(name string) error {
+	if !sh.InFunction() {
+		return fmt.Errorf("can only be used in a function")
+	}
+
+	frame := sh.Frames[len(sh.Frames)-1]
+	if _, ok := frame.saved[name]; ok {
+		return nil
+	}
+
+	old := sh.Vars[name]
+	if old != nil && old.ReadOnly {
+		return fmt.Errorf("%s: readonly variable", name)
+	}
+	frame.saved[name] = old
+	sh.Vars[name] = &Var{Unset: true}
+
+	return nil
+}
+
+// DefineFunc saves the function, replacing the old one with the same name.
+func (sh *Shell) DefineFunc(fn *ast.FuncDecl) {
+	sh.Funcs[fn.Name] = fn
+}
+
+// special returns the variables the shell keeps itself.
+func (sh *Shell) special(name string) (string, bool) {
+	switch name {
+	case "LINENO":
+		return strconv.Itoa(sh.Lineno), true
+	case "_":
+		return sh.LastArg, true
+	}
+	return "", false
+}
+
+// specialArray returns the arrays the shell keeps itself.
+func (sh *Shell) specialArray(name string) (*Var, bool) {
+	switch name {
+	case "FUNCNAME":
+		// the running function first, then the functions that called it
+		if !sh.InFunction() {
+			return nil, false
+		}
+		v := &Var{Array: make(map[int]string, len(sh.Frames))}
+		for i, frame := range sh.Frames {
+			v.Array[len(sh.Frames)-1-i] = frame.Func
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// Save copies the variables, the returned func puts the copies back.
+// Assignments before a builtin or a function last only until it ends.
+func (sh *Shell) Save(names []string) (restore func()) {
+	saved := make(map[string]*Var, len(names))
+	for _, name := range names {
+		if v, ok := sh.Vars[name]; ok {
+			saved[name] = v.copy()
+		} else {
+			saved[name] = nil
+		}
+	}
+
+	return func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(sh.Vars, name)
+			} else {
+				sh.Vars[name] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/ast"
+)
+
+// Shell holds the state of the running shell session.
+type Shell struct {
+	Name 		string			// $0, name of the shell or of the script being run
+	Params 		[]string		// positional parameters $1 ... $N
+	Interactive bool			// commands are read from a terminal with readline
+	Dir 		string			// working directory, the process itself never changes its own
+	Status 		int				// exit status of the last command ($?)
+	Lineno 		int				// line of the running command ($LINENO)
+	Vars 		map[string]*Var
+	Funcs 		map[string]*ast.FuncDecl
+	Frames 		[]*Frame		// calls of functions, the innermost last
+	LastArg 	string			// last argument of the previous command ($_)
+	LastJob 	*Job			// the last started background job ($!)
+	Opts 		map[string]bool	// options of set -o that are on
+}
+
+// NewShell creates the state with the variables from the environment of the process.
+func NewShell(name string) *Shell {
+	sh := &Shell{
+		Name: name,
+		Params: []string{},
+		Vars: make(map[string]*Var),
+		Funcs: make(map[string]*ast.FuncDecl),
+		Opts: make(map[string]bool),
+	}
+	sh.Dir, _ = os.Getwd()
+
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok {
+			sh.Vars[name] = &Var{Value: value, Exported: true}
+		}
+	}
+
+	return sh
+}
+
+// Path returns the filename relative to the working directory of the shell.
+func (sh *Shell) Path(name string) string {
+	if name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(sh.Dir, name)
+}
+
+// Chdir changes the working directory and updates PWD and OLDPWD.
+func (sh *Shell) Chdir(dir string) {
+	sh.Set("OLDPWD", sh.Dir)
+	sh.Dir = dir
+	sh.Set("PWD", dir)
+}
+
+// Environ returns the exported variables in the form "name=value".
+func (sh *Shell) Environ() []string {
+	env := make([]string, 0, len(sh.Vars))
+	for name, v := range sh.Vars {
+		if v.Exported && !v.Unset && v.Array == nil && v.Assoc == nil && !v.NameRef {
+			env = append(env, name + "=" + v.Value)
+		}
+	}
+	sort.Strings(env)
+
+	return env
+}
+
+// Clone returns a copy of the state for commands that must not change the current shell,
+// like the commands of a pipeline.
+func (sh *Shell) Clone() *Shell {
+	clone := *sh
+	clone.Params = append([]string{}, sh.Params...)
+	clone.Vars = make(map[string]*Var, len(sh.Vars))
+	for name, v := range sh.Vars {
+		clone.Vars[name] = v.copy()
+	}
+
+	clone.Opts = make(map[string]bool, len(sh.Opts))
+	for name, on := range sh.Opts {
+		clone.Opts[name] = on
+	}
+
+	clone.Funcs = make(map[string]*ast.FuncDecl, len(sh.Funcs))
+	for name, fn := range sh.Funcs {
+		clone.Funcs[name] = fn
+	}
+
+	clone.Frames = make([]*Frame, len(sh.Frames))
+	for i, frame := range sh.Frames {
+		copyFrame := *frame
+		copyFrame.saved = make(map[string]*Var, len(frame.saved))
+		for name, v := range frame.saved {
+			if v != nil {
+				v = v.copy()
+			}
+			copyFrame.saved[name] = v
+		}
+		clone.Frames[i] = &copyFrame
+	}
+
+	return &clone
+}
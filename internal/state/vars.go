@@ -0,0 +1,408 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/shell-starter-go/internal/arith"
+)
+
+// Var is a shell variable.
+type Var struct {
+	Value 	 string
+	Array 	 map[int]string		// elements of an indexed array, nil for other variables
+	Assoc 	 map[string]string	// elements of an associative array, nil for other variables
+	Exported bool				// passed to the environment of commands
+	ReadOnly bool
+	Integer  bool				// assigned values are evaluated as arithmetic expressions
+	Lower 	 bool				// assigned values are converted to lower case
+	Upper 	 bool				// assigned values are converted to upper case
+	NameRef  bool				// Value is the name of the variable it refers to
+	Unset 	 bool				// declared without a value, like local x, it is set by the first assignment
+}
+
+// the longest chain of namerefs that is followed
+const maxRefs = 8
+
+// SplitSubscript splits name[subscript].
+func SplitSubscript(name string) (base, sub string, hasSub bool) {
+	i := strings.IndexByte(name, '[')
+	if i <= 0 || !strings.HasSuffix(name, "]") {
+		return name, "", false
+	}
+	return name[:i], name[i+1:len(name)-1], true
+}
+
+// ref splits name[subscript] and follows the namerefs to the variable they refer to.
+func (sh *Shell) ref(name string) (base, sub string, hasSub bool) {
+	for i := 0; i < maxRefs; i++ {
+		base, sub, hasSub = SplitSubscript(name)
+		v, ok := sh.Vars[base]
+		if !ok || !v.NameRef || hasSub || v.Value == "" {
+			return base, sub, hasSub
+		}
+		name = v.Value
+	}
+	return base, sub, hasSub
+}
+
+// lookup returns the variable, the arrays of the shell like FUNCNAME too.
+func (sh *Shell) lookup(base string) (*Var, bool) {
+	if v, ok := sh.specialArray(base); ok {
+		return v, true
+	}
+	v, ok := sh.Vars[base]
+	return v, ok
+}
+
+// index evaluates the subscript of an indexed array, negative indexes count from the end.
+func (sh *Shell) index(v *Var, sub string) (int, error) {
+	n, err := arith.Eval(sub, sh)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		n += int64(maxIndex(v) + 1)
+		if n < 0 {
+			return 0, fmt.Errorf("%s: bad array subscript", sub)
+		}
+	}
+	return int(n), nil
+}
+
+func maxIndex(v *Var) int {
+	max := -1
+	for i := range v.Array {
+		if i > max {
+			max = i
+		}
+	}
+	return max
+}
+
+// Get returns the value of the variable and true if it is set.
+// The name may have a [subscript], an array without it is its element 0.
+func (sh *Shell) Get(name string) (string, bool) {
+	if value, ok := sh.special(name); ok {
+		return value, true
+	}
+
+	base, sub, hasSub := sh.ref(name)
+	v, ok := sh.lookup(base)
+	if !ok || v.Unset {
+		return "", false
+	}
+	if !hasSub {
+		sub = "0"
+	}
+
+	switch {
+	case v.Assoc != nil:
+		value, ok := v.Assoc[sub]
+		return value, ok
+	case v.Array != nil:
+		i, err := sh.index(v, sub)
+		if err != nil {
+			return "", false
+		}
+		value, ok := v.Array[i]
+		return value, ok
+	case hasSub:
+		// a variable that is not an array is its element 0
+		i, err := sh.index(v, sub)
+		return v.Value, err == nil && i == 0
+	}
+	return v.Value, true
+}
+
+// Set assigns the value to the variable, creating it if needed.
+// The name may have a [subscript], which makes the variable an array.
+func (sh *Shell) Set(name, value string) error {
+	base, sub, hasSub := sh.ref(name)
+	v, ok := sh.Vars[base]
+	if !ok {
+		v = &Var{}
+	}
+	if v.ReadOnly {
+		return fmt.Errorf("%s: readonly variable", base)
+	}
+
+	value, err := sh.convert(v, value)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case v.Assoc != nil:
+		if !hasSub {
+			sub = "0"
+		}
+		v.Assoc[sub] = value
+	case v.Array != nil || hasSub:
+		i := 0
+		if hasSub {
+			if i, err = sh.index(v, sub); err != nil {
+				return err
+			}
+		}
+		if v.Array == nil {
+			v.Array = make(map[int]string)
+			if ok && !v.Unset {
+				v.Array[0] = v.Value
+			}
+			v.Value = ""
+		}
+		v.Array[i] = value
+	default:
+		v.Value = value
+	}
+
+	v.Unset = false
+	sh.Vars[base] = v
+	return nil
+}
+
+// convert applies the attributes of the variable to an assigned value.
+func (sh *Shell) convert(v *Var, value string) (string, error) {
+	switch {
+	case v.Integer:
+		n, err := arith.Eval(value, sh)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(n, 10), nil
+	case v.Lower:
+		return strings.ToLower(value), nil
+	case v.Upper:
+		return strings.ToUpper(value), nil
+	}
+	return value, nil
+}
+
+// Append runs name+=value, which adds numbers for integer variables.
+func (sh *Shell) Append(name, value string) error {
+	old, _ := sh.Get(name)
+
+	base, _, _ := sh.ref(name)
+	if v, ok := sh.Vars[base]; ok && v.Integer {
+		if old == "" {
+			old = "0"
+		}
+		return sh.Set(name, old + "+(" + value + ")")
+	}
+
+	return sh.Set(name, old + value)
+}
+
+// Export marks the variable to be passed to the environment of commands.
+func (sh *Shell) Export(name string) {
+	v, ok := sh.Vars[name]
+	if !ok {
+		v = &Var{Unset: true}
+		sh.Vars[name] = v
+	}
+	v.Exported = true
+}
+
+// Unset removes the variable, or only the element with a [subscript].
+func (sh *Shell) Unset(name string) error {
+	base, sub, hasSub := sh.ref(name)
+	v, ok := sh.Vars[base]
+	if !ok {
+		return nil
+	}
+	if v.ReadOnly {
+		return fmt.Errorf("%s: cannot unset: readonly variable", base)
+	}
+
+	switch {
+	case !hasSub:
+		delete(sh.Vars, base)
+	case v.Assoc != nil:
+		delete(v.Assoc, sub)
+	case v.Array != nil:
+		i, err := sh.index(v, sub)
+		if err != nil {
+			return err
+		}
+		delete(v.Array, i)
+	}
+	return nil
+}
+
+// IsAssoc reports whether the variable is an associative array.
+func (sh *Shell) IsAssoc(name string) bool {
+	base, _, _ := sh.ref(name)
+	v, ok := sh.Vars[base]
+	return ok && v.Assoc != nil
+}
+
+// InitArray makes the variable an empty array, associative if assoc is true.
+func (sh *Shell) InitArray(name string, assoc bool) error {
+	base, _, _ := sh.ref(name)
+	v, ok := sh.Vars[base]
+	if !ok {
+		v = &Var{}
+		sh.Vars[base] = v
+	}
+	if v.ReadOnly {
+		return fmt.Errorf("%s: readonly variable", base)
+	}
+
+	v.Value, v.Unset = "", false
+	if assoc {
+		v.Array, v.Assoc = nil, make(map[string]string)
+	} else {
+		v.Array, v.Assoc = make(map[int]string), nil
+	}
+	return nil
+}
+
+// SetArray assigns the values to the indexed array from index 0.
+func (sh *Shell) SetArray(name string, values []string) error {
+	if err := sh.InitArray(name, false); err != nil {
+		return err
+	}
+	for i, value := range values {
+		if err := sh.Set(fmt.Sprintf("%s[%d]", name, i), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextIndex returns the index after the last element of the indexed array.
+func (sh *Shell) NextIndex(name string) int {
+	base, _, _ := sh.ref(name)
+	v, ok := sh.Vars[base]
+	switch {
+	case !ok:
+		return 0
+	case v.Array == nil:
+		return 1
+	}
+	return maxIndex(v) + 1
+}
+
+// Keys returns the indexes or the keys of the elements of the array in order.
+// A variable that is not an array has the key 0.
+func (sh *Shell) Keys(name string) []string {
+	base, _, _ := sh.ref(name)
+	v, ok := sh.lookup(base)
+	switch {
+	case !ok, v.Unset:
+		return nil
+	case v.Assoc != nil:
+		keys := make([]string, 0, len(v.Assoc))
+		for key := range v.Assoc {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return keys
+	case v.Array != nil:
+		indexes := make([]int, 0, len(v.Array))
+		for i := range v.Array {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+
+		keys := make([]string, len(indexes))
+		for i, index := range indexes {
+			keys[i] = strconv.Itoa(index)
+		}
+		return keys
+	}
+	return []string{"0"}
+}
+
+// Elems returns the elements of the array in the order of Keys.
+func (sh *Shell) Elems(name string) []string {
+	base, _, _ := sh.ref(name)
+	v, ok := sh.lookup(base)
+	if !ok {
+		return nil
+	}
+
+	keys := sh.Keys(name)
+	elems := make([]string, len(keys))
+	for i, key := range keys {
+		switch {
+		case v.Assoc != nil:
+			elems[i] = v.Assoc[key]
+		case v.Array != nil:
+			n, _ := strconv.Atoi(key)
+			elems[i] = v.Array[n]
+		default:
+			elems[i] = v.Value
+		}
+	}
+	return elems
+}
+
+func (v *Var) copy() *Var {
+	copyVar := *v
+	if v.Array != nil {
+		copyVar.Array = make(map[int]string, len(v.Array))
+		for i, elem := range v.Array {
+			copyVar.Array[i] = elem
+		}
+	}
+	if v.Assoc != nil {
+		copyVar.Assoc = make(map[string]string, len(v.Assoc))
+		for key, elem := range v.Assoc {
+			copyVar.Assoc[key] = elem
+		}
+	}
+	return &copyVar
+}
+
+// Elem is an element of a compound array value (...), [key]=value or a value.
+type Elem struct {
+	Key   string
+	Keyed bool
+	Value string
+}
+
+// AssignArray runs name=(...) or name+=(...) with the expanded elements.
+// Elements without a key follow the previous element of an indexed array,
+// in an associative array they are pairs of a key and a value.
+func (sh *Shell) AssignArray(name string, elems []Elem, appendTo bool) error {
+	assoc := sh.IsAssoc(name)
+	next := 0
+	if appendTo {
+		next = sh.NextIndex(name)
+	} else if err := sh.InitArray(name, assoc); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(elems); i++ {
+		elem := elems[i]
+		key := elem.Key
+		switch {
+		case assoc && !elem.Keyed:
+			// an associative array takes key value pairs
+			key, elem.Value = elem.Value, ""
+			if i + 1 < len(elems) {
+				i++
+				elem.Value = elems[i].Value
+			}
+		case !assoc && elem.Keyed:
+			i, err := arith.Eval(key, sh)
+			if err != nil {
+				return err
+			}
+			next = int(i)
+			fallthrough
+		case !assoc:
+			key = strconv.Itoa(next)
+			next++
+		}
+
+		if err := sh.Set(name + "[" + key + "]", elem.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -16,8 +16,8 @@ func PrintLookPath(cmd, path string) string {
 	return fmt.Sprintf("%s is %s", cmd, path)
 }
 
-func GetListPath() []string {
-	pathEnv := os.Getenv("PATH")
+// SplitPath splits the value of PATH into directories.
+func SplitPath(pathEnv string) []string {
 	if pathEnv == "" {
 		return nil
 	}
@@ -25,8 +25,23 @@ func GetListPath() []string {
 	return filepath.SplitList(pathEnv)
 }
 
+// LookPath searches for an executable filename in PATH.
+// A filename containing a slash is not searched, it is checked as is.
 func LookPath(filename string) string {
-	listPath := GetListPath()
+	return LookPathIn(filename, os.Getenv("PATH"))
+}
+
+// LookPathIn is LookPath with the given value of PATH.
+func LookPathIn(filename, pathEnv string) string {
+	if strings.Contains(filename, "/") {
+		info, err := os.Stat(filename)
+		if err != nil || info.IsDir() || !IsExecutable(filename, info) {
+			return ""
+		}
+		return filename
+	}
+
+	listPath := SplitPath(pathEnv)
 	if listPath == nil {
 		return ""
 	}
@@ -0,0 +1,162 @@
+package pattern
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// compiled patterns, the same patterns are matched again and again in loops
+var cache sync.Map
+
+// Match reports whether the whole name matches the shell pattern pat.
+// Patterns support *, ?, [...] with ! or ^ negation and [:class:], \ quotes the next character.
+func Match(pat, name string) bool {
+	re, err := compile(pat)
+	if err != nil {
+		return pat == name
+	}
+	return re.MatchString(name)
+}
+
+func compile(pat string) (*regexp.Regexp, error) {
+	if re, ok := cache.Load(pat); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile("^(?s:" + Regexp(pat) + ")$")
+	if err != nil {
+		return nil, err
+	}
+	cache.Store(pat, re)
+
+	return re, nil
+}
+
+// Regexp translates the shell pattern into a regular expression without anchors.
+func Regexp(pat string) string {
+	buf := strings.Builder{}
+
+	for i := 0; i < len(pat); i++ {
+		ch := pat[i]
+		switch ch {
+		case '\\':
+			if i + 1 < len(pat) {
+				i++
+				buf.WriteString(regexp.QuoteMeta(pat[i:i+1]))
+			} else {
+				buf.WriteString(`\\`)
+			}
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		case '[':
+			class, end := bracket(pat, i)
+			if end == -1 {
+				buf.WriteString(`\[`)
+			} else {
+				buf.WriteString(class)
+				i = end
+			}
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	return buf.String()
+}
+
+// bracket translates [...] starting at pat[start].
+// Returns the index of the closing bracket or -1 if it is not closed.
+func bracket(pat string, start int) (string, int) {
+	buf := strings.Builder{}
+	buf.WriteByte('[')
+
+	i := start + 1
+	if i < len(pat) && (pat[i] == '!' || pat[i] == '^') {
+		buf.WriteByte('^')
+		i++
+	}
+
+	first := true
+	for ; i < len(pat); i++ {
+		ch := pat[i]
+		switch {
+		case ch == ']' && !first:
+			buf.WriteByte(']')
+			return buf.String(), i
+		case ch == '[' && strings.HasPrefix(pat[i:], "[:"):
+			end := strings.Index(pat[i+2:], ":]")
+			if end == -1 {
+				buf.WriteString(`\[`)
+			} else {
+				buf.WriteString(pat[i:i+end+4])
+				i += end + 3
+			}
+		case ch == '\\' && i + 1 < len(pat):
+			i++
+			buf.WriteString(quoteInBracket(pat[i]))
+		case ch == '\\' || ch == '[' || ch == ']' || ch == '^':
+			buf.WriteString(quoteInBracket(ch))
+		default:
+			buf.WriteByte(ch)
+		}
+		first = false
+	}
+
+	return "", -1
+}
+
+func quoteInBracket(ch byte) string {
+	if ch < 0x80 && !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9') {
+		return `\` + string(ch)
+	}
+	return string(ch)
+}
+
+// HasMeta reports whether pat has special characters that are not quoted.
+func HasMeta(pat string) bool {
+	for i := 0; i < len(pat); i++ {
+		switch pat[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// Quote escapes special characters of s, so that as a pattern it matches only s itself.
+func Quote(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+
+	buf := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// Unquote removes the backslashes of a pattern without special characters.
+func Unquote(pat string) string {
+	if !strings.Contains(pat, `\`) {
+		return pat
+	}
+
+	buf := strings.Builder{}
+	for i := 0; i < len(pat); i++ {
+		if pat[i] == '\\' && i + 1 < len(pat) {
+			i++
+		}
+		buf.WriteByte(pat[i])
+	}
+	return buf.String()
+}
@@ -0,0 +1,100 @@
+package strftime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Format formats the time like strftime(3) in the C locale.
+// Unknown conversions are copied as they are.
+func Format(format string, t time.Time) string {
+	buf := strings.Builder{}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i + 1 == len(format) {
+			buf.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'a':
+			buf.WriteString(t.Format("Mon"))
+		case 'A':
+			buf.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			buf.WriteString(t.Format("Jan"))
+		case 'B':
+			buf.WriteString(t.Format("January"))
+		case 'c':
+			buf.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			fmt.Fprintf(&buf, "%02d", t.Year() / 100)
+		case 'd':
+			fmt.Fprintf(&buf, "%02d", t.Day())
+		case 'D', 'x':
+			buf.WriteString(t.Format("01/02/06"))
+		case 'e':
+			fmt.Fprintf(&buf, "%2d", t.Day())
+		case 'F':
+			buf.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			fmt.Fprintf(&buf, "%02d", t.Hour())
+		case 'I':
+			fmt.Fprintf(&buf, "%02d", hour12(t))
+		case 'j':
+			fmt.Fprintf(&buf, "%03d", t.YearDay())
+		case 'k':
+			fmt.Fprintf(&buf, "%2d", t.Hour())
+		case 'l':
+			fmt.Fprintf(&buf, "%2d", hour12(t))
+		case 'm':
+			fmt.Fprintf(&buf, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&buf, "%02d", t.Minute())
+		case 'n':
+			buf.WriteByte('\n')
+		case 'p':
+			buf.WriteString(t.Format("PM"))
+		case 'r':
+			buf.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			buf.WriteString(t.Format("15:04"))
+		case 's':
+			fmt.Fprintf(&buf, "%d", t.Unix())
+		case 'S':
+			fmt.Fprintf(&buf, "%02d", t.Second())
+		case 't':
+			buf.WriteByte('\t')
+		case 'T', 'X':
+			buf.WriteString(t.Format("15:04:05"))
+		case 'u':
+			fmt.Fprintf(&buf, "%d", (int(t.Weekday()) + 6) % 7 + 1)
+		case 'w':
+			fmt.Fprintf(&buf, "%d", int(t.Weekday()))
+		case 'y':
+			fmt.Fprintf(&buf, "%02d", t.Year() % 100)
+		case 'Y':
+			fmt.Fprintf(&buf, "%d", t.Year())
+		case 'z':
+			buf.WriteString(t.Format("-0700"))
+		case 'Z':
+			buf.WriteString(t.Format("MST"))
+		case '%':
+			buf.WriteByte('%')
+		default:
+			buf.WriteByte('%')
+			buf.WriteByte(format[i])
+		}
+	}
+
+	return buf.String()
+}
+
+func hour12(t time.Time) int {
+	h := t.Hour() % 12
+	if h == 0 {
+		h = 12
+	}
+	return h
+}
@@ -0,0 +1,70 @@
+package term
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// ErrTimeout is returned by Wait when no input arrives in time.
+var ErrTimeout = errors.New("timeout")
+
+// IsTerminal reports whether the descriptor is a terminal.
+func IsTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	return err == nil
+}
+
+// Mode changes the terminal: echo false stops showing the typed characters,
+// canonical false passes every character without waiting for the end of the line.
+// Returns the func that restores the old mode.
+func Mode(fd int, echo, canonical bool) (restore func(), err error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := *old
+	if !echo {
+		mode.Lflag &^= unix.ECHO
+	}
+	if !canonical {
+		mode.Lflag &^= unix.ICANON
+		mode.Cc[unix.VMIN] = 1
+		mode.Cc[unix.VTIME] = 0
+	}
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &mode); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, ioctlSetTermios, old)
+	}, nil
+}
+
+// Wait waits until the descriptor has input or the deadline passes.
+// Returns at once for the zero deadline.
+func Wait(fd int, deadline time.Time) error {
+	if deadline.IsZero() {
+		return nil
+	}
+
+	for {
+		timeout := int(time.Until(deadline) / time.Millisecond)
+		if timeout < 0 {
+			timeout = 0
+		}
+
+		n, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, timeout)
+		switch {
+		case errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return err
+		case n == 0:
+			return ErrTimeout
+		}
+		return nil
+	}
+}